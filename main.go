@@ -38,9 +38,12 @@ func main() {
 		logrus.Fatalf("Command %s not found.", command)
 	}
 
-	app.Action = app.Commands[0].Action
-	app.Flags = app.Commands[0].Flags
-	app.Before = app.Commands[0].Before
+	// commands register in the order of their files, the server is the default whatever its position
+	defaultCommand := app.Command("server")
+
+	app.Action = defaultCommand.Action
+	app.Flags = defaultCommand.Flags
+	app.Before = defaultCommand.Before
 
 	if err := app.Run(os.Args); err != nil {
 		logrus.Fatal(err)
@@ -0,0 +1,345 @@
+// Package audit records the events of a monitor to local files that outlive the metrics
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+const (
+	// DefaultMaxSize is the size above which the audit log is rotated when no max_size is given
+	DefaultMaxSize = 100 * 1024 * 1024
+
+	// DefaultSyncInterval is how often events are flushed to disk when no sync_interval is given
+	DefaultSyncInterval = time.Second
+)
+
+// Options configures a Log
+type Options struct {
+	// Registerer is where the metrics of the log are registered, defaults to prometheus.DefaultRegisterer
+	Registerer prometheus.Registerer
+
+	// Logger defaults to the standard logrus logger
+	Logger *logrus.Logger
+}
+
+type metrics struct {
+	records   prometheus.Counter
+	errors    prometheus.Counter
+	rotations prometheus.Counter
+}
+
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		records: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_exporter_audit_records_total",
+			Help: "Events written to the audit log",
+		}),
+
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_exporter_audit_errors_total",
+			Help: "Events that could not be written to the audit log",
+		}),
+
+		rotations: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_exporter_audit_rotations_total",
+			Help: "Times the audit log was rotated",
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{m.records, m.errors, m.rotations} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Log appends every event it records to a JSON Lines file, one event per line with its metadata
+// before and after the change. The file is rotated once it grows above its maximum size or age,
+// rotated files are named after the time of the rotation and optionally compressed.
+type Log struct {
+	cfg      config.AuditLog
+	metrics  *metrics
+	logEntry *logrus.Entry
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	opened  time.Time
+	dirty   bool
+	closed  bool
+	stop    chan struct{}
+	workers sync.WaitGroup
+
+	// segmentsMu serializes the compression and removal of rotated files
+	segmentsMu sync.Mutex
+}
+
+// New opens the audit log, records are appended to the file when it exists
+func New(cfg config.AuditLog, opts Options) (*Log, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Path == "" {
+		return nil, errors.New("audit_log: path must be set")
+	}
+
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = DefaultMaxSize
+	}
+
+	if cfg.SyncInterval.Duration == 0 && !cfg.SyncEveryEvent {
+		cfg.SyncInterval.Duration = DefaultSyncInterval
+	}
+
+	reg := opts.Registerer
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	log := opts.Logger
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+
+	metrics, err := newMetrics(reg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to register audit metrics: %w", err)
+	}
+
+	l := &Log{
+		cfg:      cfg,
+		metrics:  metrics,
+		logEntry: log.WithField("component", "audit"),
+		stop:     make(chan struct{}),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o750); err != nil {
+		return nil, err
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	// segments left behind by a previous run are compressed and pruned now
+	if cfg.Compress || cfg.MaxSegments > 0 {
+		l.workers.Add(1)
+		go l.tidySegments()
+	}
+
+	l.workers.Add(1)
+	go l.run()
+
+	return l, nil
+}
+
+// Record appends an event to the log, rotating it first when it is due
+func (l *Log) Record(event monitor.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		l.metrics.errors.Inc()
+		return err
+	}
+
+	if err := l.write(append(data, '\n')); err != nil {
+		l.metrics.errors.Inc()
+		return fmt.Errorf("unable to write audit log: %w", err)
+	}
+
+	l.metrics.records.Inc()
+
+	return nil
+}
+
+// Close flushes the log to disk and waits for rotated files to be compressed
+func (l *Log) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+
+	l.closed = true
+	close(l.stop)
+
+	err := l.file.Sync()
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.mu.Unlock()
+
+	l.workers.Wait()
+
+	return err
+}
+
+func (l *Log) write(line []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return os.ErrClosed
+	}
+
+	if l.size > 0 && (l.size+int64(len(line)) > l.cfg.MaxSize || l.expired()) {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if l.cfg.SyncEveryEvent {
+		return l.file.Sync()
+	}
+
+	l.dirty = true
+
+	return nil
+}
+
+// run syncs the log on its cadence and rotates it once it is too old, even when no event comes
+func (l *Log) run() {
+	defer l.workers.Done()
+
+	interval := l.cfg.SyncInterval.Duration
+	if age := l.cfg.MaxAge.Duration; age > 0 {
+		check := min(age, time.Minute)
+		if interval == 0 || check < interval {
+			interval = check
+		}
+	}
+
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.stop:
+			return
+		}
+
+		l.mu.Lock()
+
+		if l.dirty && !l.closed {
+			if err := l.file.Sync(); err != nil {
+				l.logEntry.WithError(err).Error("unable to sync audit log")
+			}
+			l.dirty = false
+		}
+
+		if l.size > 0 && l.expired() && !l.closed {
+			if err := l.rotate(); err != nil {
+				l.logEntry.WithError(err).Error("unable to rotate audit log")
+			}
+		}
+
+		l.mu.Unlock()
+	}
+}
+
+func (l *Log) expired() bool {
+	return l.cfg.MaxAge.Duration > 0 && time.Since(l.opened) >= l.cfg.MaxAge.Duration
+}
+
+// open opens the file for appending. The age of an existing file is the time of its first event,
+// and a line left incomplete by a crash is terminated so the next event starts on its own line.
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.size = info.Size()
+	l.opened = time.Now()
+	l.dirty = false
+
+	if l.size == 0 {
+		return nil
+	}
+
+	if t, ok := firstEventTime(l.cfg.Path); ok {
+		l.opened = t
+	}
+
+	if !endsWithNewline(l.cfg.Path, l.size) {
+		n, err := file.Write([]byte{'\n'})
+		l.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func firstEventTime(path string) (time.Time, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return time.Time{}, false
+	}
+
+	var event struct {
+		Time time.Time `json:"time"`
+	}
+
+	if err := json.Unmarshal(line, &event); err != nil || event.Time.IsZero() {
+		return time.Time{}, false
+	}
+
+	return event.Time, true
+}
+
+func endsWithNewline(path string, size int64) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	b := make([]byte, 1)
+	if _, err := file.ReadAt(b, size-1); err != nil {
+		return true
+	}
+
+	return b[0] == '\n'
+}
@@ -0,0 +1,372 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// openLog opens an audit log in a new directory, every test event is a single line of about 70 bytes
+func openLog(t *testing.T, cfg config.AuditLog) *Log {
+	t.Helper()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	l, err := New(cfg, Options{Registerer: prometheus.NewRegistry(), Logger: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func record(t *testing.T, l *Log, paths ...string) {
+	t.Helper()
+
+	for _, path := range paths {
+		if err := l.Record(monitor.Event{Time: time.Now().UTC(), Op: "WRITE", Path: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// pathsIn returns the path of every event in a file, compressed or not, and fails on a line that
+// is not an event
+func pathsIn(t *testing.T, file string) []string {
+	t.Helper()
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	}
+
+	paths := []string{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var event monitor.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("%s: %q: %v", file, scanner.Text(), err)
+		}
+		paths = append(paths, event.Path)
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return paths
+}
+
+// files lists the files of a directory by name
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func TestRotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		compress    bool
+		maxSegments int
+
+		// segments are the events of each rotated file, oldest first
+		segments [][]string
+		current  []string
+	}{
+		{
+			name:     "rotated",
+			segments: [][]string{{"/a"}, {"/b"}, {"/c"}},
+			current:  []string{"/d"},
+		},
+		{
+			name:     "compressed",
+			compress: true,
+			segments: [][]string{{"/a"}, {"/b"}, {"/c"}},
+			current:  []string{"/d"},
+		},
+		{
+			name:        "pruned",
+			maxSegments: 2,
+			segments:    [][]string{{"/b"}, {"/c"}},
+			current:     []string{"/d"},
+		},
+		{
+			name:        "compressed and pruned",
+			compress:    true,
+			maxSegments: 1,
+			segments:    [][]string{{"/c"}},
+			current:     []string{"/d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			l := openLog(t, config.AuditLog{
+				Path:        filepath.Join(dir, "audit.jsonl"),
+				MaxSize:     100,
+				Compress:    tt.compress,
+				MaxSegments: tt.maxSegments,
+			})
+
+			record(t, l, "/a", "/b", "/c", "/d")
+
+			// Close waits for the rotated files to be compressed and pruned
+			if err := l.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := testutil.ToFloat64(l.metrics.rotations); got != 3 {
+				t.Errorf("rotated %v times, want 3", got)
+			}
+
+			if got := testutil.ToFloat64(l.metrics.records); got != 4 {
+				t.Errorf("recorded %v events, want 4", got)
+			}
+
+			segments := l.segments()
+			if len(segments) != len(tt.segments) {
+				t.Fatalf("segments %v, want %d", files(t, dir), len(tt.segments))
+			}
+
+			for i, segment := range segments {
+				if compressed := strings.HasSuffix(segment, ".gz"); compressed != tt.compress {
+					t.Errorf("segment %s compressed %v, want %v", segment, compressed, tt.compress)
+				}
+
+				if got := pathsIn(t, segment); !reflect.DeepEqual(got, tt.segments[i]) {
+					t.Errorf("segment %s holds %v, want %v", segment, got, tt.segments[i])
+				}
+			}
+
+			if got := pathsIn(t, l.cfg.Path); !reflect.DeepEqual(got, tt.current) {
+				t.Errorf("current file holds %v, want %v", got, tt.current)
+			}
+
+			if got := len(files(t, dir)); got != len(tt.segments)+1 {
+				t.Errorf("directory holds %v, want only the segments and the current file", files(t, dir))
+			}
+		})
+	}
+}
+
+func TestRotationByAge(t *testing.T) {
+	dir := t.TempDir()
+
+	l := openLog(t, config.AuditLog{
+		Path:   filepath.Join(dir, "audit.jsonl"),
+		MaxAge: config.Duration{Duration: 50 * time.Millisecond},
+	})
+	defer l.Close()
+
+	record(t, l, "/a")
+
+	// the log is rotated once it is too old even when no other event comes
+	for deadline := time.Now().Add(5 * time.Second); len(l.segments()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("audit log not rotated by age: %v", files(t, dir))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	record(t, l, "/b")
+
+	if got := pathsIn(t, l.segments()[0]); !reflect.DeepEqual(got, []string{"/a"}) {
+		t.Errorf("segment holds %v, want [/a]", got)
+	}
+
+	if got := pathsIn(t, l.cfg.Path); !reflect.DeepEqual(got, []string{"/b"}) {
+		t.Errorf("current file holds %v, want [/b]", got)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+
+	l := openLog(t, config.AuditLog{Path: path})
+	record(t, l, "/a")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash in the middle of a write leaves an incomplete line behind
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"time":"2026-10`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	l = openLog(t, config.AuditLog{Path: path})
+	record(t, l, "/b")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 || lines[1] != `{"time":"2026-10` {
+		t.Fatalf("audit log %q, want the incomplete line on its own", data)
+	}
+
+	var event monitor.Event
+	if err := json.Unmarshal([]byte(lines[2]), &event); err != nil || event.Path != "/b" {
+		t.Fatalf("last line %q is not the new event: %v", lines[2], err)
+	}
+}
+
+func TestTidySegments(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+
+	// a previous run rotated without compressing
+	l := openLog(t, config.AuditLog{Path: path, MaxSize: 100})
+	record(t, l, "/a", "/b", "/c")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l = openLog(t, config.AuditLog{Path: path, MaxSize: 100, Compress: true, MaxSegments: 1})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments := l.segments()
+	if len(segments) != 1 || !strings.HasSuffix(segments[0], ".gz") {
+		t.Fatalf("segments %v, want the newest one compressed", files(t, dir))
+	}
+
+	if got := pathsIn(t, segments[0]); !reflect.DeepEqual(got, []string{"/b"}) {
+		t.Errorf("segment holds %v, want [/b]", got)
+	}
+}
+
+func TestSegmentsIgnoreOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	// files that share the name of the log without being rotated from it
+	others := []string{"audit-backup.jsonl", "audit-20261018.jsonl", "audit-old.jsonl.gz", "other-20261018T054400.000000000Z.jsonl"}
+	for _, name := range others {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("keep\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := openLog(t, config.AuditLog{
+		Path:        filepath.Join(dir, "audit.jsonl"),
+		MaxSize:     100,
+		MaxSegments: 1,
+		Compress:    true,
+	})
+
+	record(t, l, "/a", "/b", "/c")
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if segments := l.segments(); len(segments) != 1 {
+		t.Fatalf("segments %v, want only the newest rotated file", segments)
+	}
+
+	for _, name := range others {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != "keep\n" {
+			t.Errorf("%s was changed by the rotation: %q, %v", name, data, err)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.AuditLog
+		interval time.Duration
+		dirty    bool
+	}{
+		{
+			name:     "periodic by default",
+			interval: DefaultSyncInterval,
+			dirty:    true,
+		},
+		{
+			name:     "configured interval",
+			cfg:      config.AuditLog{SyncInterval: config.Duration{Duration: time.Minute}},
+			interval: time.Minute,
+			dirty:    true,
+		},
+		{
+			name: "every event",
+			cfg:  config.AuditLog{SyncEveryEvent: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Path = filepath.Join(t.TempDir(), "audit.jsonl")
+
+			l := openLog(t, tt.cfg)
+			defer l.Close()
+
+			if l.cfg.SyncInterval.Duration != tt.interval {
+				t.Errorf("sync interval %s, want %s", l.cfg.SyncInterval.Duration, tt.interval)
+			}
+
+			record(t, l, "/a")
+
+			// events waiting on the next periodic sync leave the log dirty
+			l.mu.Lock()
+			dirty := l.dirty
+			l.mu.Unlock()
+
+			if dirty != tt.dirty {
+				t.Errorf("dirty %t after an event, want %t", dirty, tt.dirty)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sans-sroc/file_exporter/pkg/atomicfile"
+)
+
+// segmentTimeFormat names rotated files so they sort in the order they were rotated
+const segmentTimeFormat = "20060102T150405.000000000Z"
+
+// segmentPattern matches the rotation time of a file named with segmentTimeFormat
+const segmentPattern = `\d{8}T\d{6}\.\d{9}Z`
+
+// rotate renames the current file after the time of the rotation and opens a new one, l.mu must be held
+func (l *Log) rotate() error {
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	stem, ext := l.split()
+	segment := stem + "-" + time.Now().UTC().Format(segmentTimeFormat) + ext
+
+	if err := os.Rename(l.cfg.Path, segment); err != nil {
+		// keep appending to the current file rather than losing events
+		if oerr := l.open(); oerr != nil {
+			l.logEntry.WithError(oerr).Error("unable to reopen audit log")
+		}
+		return err
+	}
+
+	if err := l.open(); err != nil {
+		return err
+	}
+
+	l.metrics.rotations.Inc()
+	l.logEntry.WithField("segment", segment).Info("rotated audit log")
+
+	l.workers.Add(1)
+	go func() {
+		defer l.workers.Done()
+
+		l.segmentsMu.Lock()
+		defer l.segmentsMu.Unlock()
+
+		if l.cfg.Compress {
+			if err := compress(segment); err != nil {
+				l.logEntry.WithError(err).WithField("segment", segment).Error("unable to compress audit log")
+			}
+		}
+
+		l.prune()
+	}()
+
+	return nil
+}
+
+// split returns the path of the file without its extension, and the extension
+func (l *Log) split() (string, string) {
+	ext := filepath.Ext(l.cfg.Path)
+	return strings.TrimSuffix(l.cfg.Path, ext), ext
+}
+
+// segments returns the rotated files, compressed or not, oldest first. Only names made of the
+// stem, a rotation time and the extension are matched so other files next to the log are left alone.
+func (l *Log) segments() []string {
+	stem, ext := l.split()
+
+	re := regexp.MustCompile("^" + regexp.QuoteMeta(filepath.Base(stem)) + "-" + segmentPattern + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+
+	entries, err := os.ReadDir(filepath.Dir(stem))
+	if err != nil {
+		l.logEntry.WithError(err).Error("unable to list rotated audit logs")
+		return nil
+	}
+
+	var list []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && re.MatchString(entry.Name()) {
+			list = append(list, filepath.Join(filepath.Dir(stem), entry.Name()))
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return strings.TrimSuffix(list[i], ".gz") < strings.TrimSuffix(list[j], ".gz")
+	})
+
+	return list
+}
+
+// tidySegments compresses the rotated files left uncompressed by a previous run and prunes them
+func (l *Log) tidySegments() {
+	defer l.workers.Done()
+
+	l.segmentsMu.Lock()
+	defer l.segmentsMu.Unlock()
+
+	for _, segment := range l.segments() {
+		if !l.cfg.Compress || strings.HasSuffix(segment, ".gz") {
+			continue
+		}
+
+		if err := compress(segment); err != nil {
+			l.logEntry.WithError(err).WithField("segment", segment).Error("unable to compress audit log")
+		}
+	}
+
+	l.prune()
+}
+
+// prune removes the oldest rotated files above the number kept, l.segmentsMu must be held
+func (l *Log) prune() {
+	if l.cfg.MaxSegments == 0 {
+		return
+	}
+
+	segments := l.segments()
+	for len(segments) > l.cfg.MaxSegments {
+		if err := os.Remove(segments[0]); err != nil {
+			l.logEntry.WithError(err).WithField("segment", segments[0]).Error("unable to remove audit log")
+		}
+
+		segments = segments[1:]
+	}
+}
+
+// compress gzips a file atomically next to it and removes it
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	err = atomicfile.Write(path+".gz", 0o600, func(w io.Writer) error {
+		zw := gzip.NewWriter(w)
+		zw.Name = filepath.Base(path)
+
+		if _, err := io.Copy(zw, src); err != nil {
+			return err
+		}
+
+		return zw.Close()
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
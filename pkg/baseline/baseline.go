@@ -0,0 +1,134 @@
+// Package baseline captures the known good state of the monitored files in a manifest
+package baseline
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/atomicfile"
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// Version is the version of the manifest format
+const Version = 1
+
+// SignatureSuffix is appended to the path of a manifest to name its detached signature
+const SignatureSuffix = ".sig"
+
+// Manifest lists every file matched by the paths of a config with its digest and metadata
+type Manifest struct {
+	Version   int       `json:"version"`
+	Created   time.Time `json:"created"`
+	Hostname  string    `json:"hostname"`
+	Algorithm string    `json:"algorithm"`
+	Files     []File    `json:"files"`
+}
+
+// File is the state of a file when the baseline was taken, its path is reported without the
+// rootfs as on the metrics
+type File struct {
+	Path    string    `json:"path"`
+	Digest  string    `json:"digest"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	UID     *uint64   `json:"uid,omitempty"`
+	GID     *uint64   `json:"gid,omitempty"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Create hashes every file matched by the paths of the config with SHA-256. Paths that do not
+// exist and files removed while the baseline is taken are logged and left out, any other error
+// stops it.
+func Create(cfg *config.Config, log *logrus.Logger) (*Manifest, error) {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+
+	logEntry := log.WithField("component", "baseline")
+
+	hostname, _ := os.Hostname()
+
+	manifest := &Manifest{
+		Version:   Version,
+		Created:   time.Now().UTC(),
+		Hostname:  hostname,
+		Algorithm: hasher.SHA256,
+		Files:     []File{},
+	}
+
+	err := monitor.Walk(cfg, func(path string, metricPath string, stat *monitor.FileStat, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			logEntry.WithField("path", path).Warn("path does not exist, it is not part of the baseline")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		result, err := hasher.File(path, hasher.SHA256)
+		if errors.Is(err, fs.ErrNotExist) {
+			logEntry.WithField("path", path).Warn("file was removed, it is not part of the baseline")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		logEntry.WithField("path", metricPath).Debug("hashed file")
+
+		manifest.Files = append(manifest.Files, File{
+			Path:    metricPath,
+			Digest:  result.Digest,
+			Size:    stat.Size,
+			Mode:    stat.Mode,
+			UID:     stat.UID,
+			GID:     stat.GID,
+			ModTime: stat.ModTime.UTC(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Write saves the manifest atomically. With a key a detached signature of the file, the base64
+// encoded ed25519 signature of its content, is written next to it with SignatureSuffix.
+func Write(path string, manifest *Manifest, key ed25519.PrivateKey) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	data = append(data, '\n')
+
+	if err := atomicfile.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+
+	// a signature of a previous manifest no longer matches
+	if key == nil {
+		if err := os.Remove(path + SignatureSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n"
+
+	return atomicfile.WriteFile(path+SignatureSuffix, []byte(signature), 0o644)
+}
@@ -0,0 +1,162 @@
+package baseline
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+func TestCreate(t *testing.T) {
+	rootfs := t.TempDir()
+
+	files := map[string]string{
+		"/etc/passwd":           "root:x:0:0::/root:/bin/sh\n",
+		"/etc/ssh/sshd_config":  "PermitRootLogin no\n",
+		"/var/log/ignored.log":  "not monitored\n",
+		"/etc/ssh/moduli.empty": "",
+	}
+
+	for path, content := range files {
+		full := filepath.Join(rootfs, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	manifest, err := Create(&config.Config{
+		RootFS: rootfs,
+		Paths: []config.Path{
+			{Path: "/etc", Recursive: true},
+			// matched again by /etc, it is only listed once
+			{Path: "/etc/passwd"},
+			// left out of the baseline
+			{Path: "/missing"},
+		},
+	}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.Version != Version || manifest.Algorithm != "sha256" || manifest.Created.IsZero() {
+		t.Errorf("manifest version %d, algorithm %q, created %v", manifest.Version, manifest.Algorithm, manifest.Created)
+	}
+
+	want := []string{"/etc/passwd", "/etc/ssh/moduli.empty", "/etc/ssh/sshd_config"}
+	if len(manifest.Files) != len(want) {
+		t.Fatalf("manifest lists %+v, want %v", manifest.Files, want)
+	}
+
+	for i, file := range manifest.Files {
+		if file.Path != want[i] {
+			t.Errorf("file %d is %s, want %s", i, file.Path, want[i])
+			continue
+		}
+
+		sum := sha256.Sum256([]byte(files[file.Path]))
+		if file.Digest != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s digest %s, want the sha256 of its content", file.Path, file.Digest)
+		}
+
+		if file.Size != int64(len(files[file.Path])) {
+			t.Errorf("%s size %d, want %d", file.Path, file.Size, len(files[file.Path]))
+		}
+
+		if file.Mode != fs.FileMode(0o640).String() {
+			t.Errorf("%s mode %s, want %s", file.Path, file.Mode, fs.FileMode(0o640))
+		}
+
+		if file.ModTime.IsZero() || file.ModTime.Location().String() != "UTC" {
+			t.Errorf("%s modification time %v, want it in UTC", file.Path, file.ModTime)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	manifest := &Manifest{
+		Version:   Version,
+		Algorithm: "sha256",
+		Files:     []File{{Path: "/etc/passwd", Digest: "00", Mode: "-rw-r--r--"}},
+	}
+
+	if err := Write(path, manifest, private); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var written Manifest
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(written.Files) != 1 || written.Files[0] != manifest.Files[0] {
+		t.Fatalf("wrote %+v, want %+v", written.Files, manifest.Files)
+	}
+
+	encoded, err := os.ReadFile(path + SignatureSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(string(encoded[:len(encoded)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ed25519.Verify(public, data, signature) {
+		t.Fatal("the signature does not match the manifest")
+	}
+
+	// a changed manifest no longer matches the signature
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-2] = ' '
+	if ed25519.Verify(public, tampered, signature) {
+		t.Fatal("the signature matches a changed manifest")
+	}
+
+	// an unsigned manifest removes the signature of the previous one
+	if err := Write(path, manifest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path + SignatureSuffix); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("signature of the previous manifest left behind: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left behind: %v", entries)
+	}
+}
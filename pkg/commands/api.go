@@ -0,0 +1,236 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// api serves what the monitor knows about the watched paths and files as JSON under /api/v1
+type api struct {
+	// ctx ends the event streams when the server shuts down
+	ctx context.Context
+
+	log    *logrus.Logger
+	mon    *monitor.Monitor
+	reload *reloader
+
+	// token authenticates the endpoints that change the monitor, they are disabled without one
+	token string
+
+	streamMetrics *streamMetrics
+}
+
+// newAPI registers the metrics of the event stream on reg
+func newAPI(ctx context.Context, log *logrus.Logger, mon *monitor.Monitor, reload *reloader, token string, reg prometheus.Registerer) (*api, error) {
+	streamMetrics, err := newStreamMetrics(reg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to register stream metrics: %w", err)
+	}
+
+	return &api{
+		ctx:           ctx,
+		log:           log,
+		mon:           mon,
+		reload:        reload,
+		token:         token,
+		streamMetrics: streamMetrics,
+	}, nil
+}
+
+func (a *api) register(router *mux.Router) {
+	v1 := router.PathPrefix("/api/v1").Subrouter()
+
+	v1.Path("/paths").Methods(http.MethodGet).HandlerFunc(a.paths)
+	v1.Path("/paths").Methods(http.MethodPost).HandlerFunc(a.authenticated(a.addPath))
+	v1.Path("/paths").Methods(http.MethodDelete).HandlerFunc(a.authenticated(a.removePath))
+	v1.Path("/events").Methods(http.MethodGet).HandlerFunc(a.events)
+	v1.Path("/events/stream").Methods(http.MethodGet).HandlerFunc(a.stream)
+	v1.Path("/files").Methods(http.MethodGet).HandlerFunc(a.files)
+	v1.Path("/files/{path:.+}").Methods(http.MethodGet).HandlerFunc(a.file)
+}
+
+// paths lists every configured path with its state
+func (a *api) paths(w http.ResponseWriter, r *http.Request) {
+	a.write(w, http.StatusOK, map[string]interface{}{
+		"paths": a.mon.Paths(),
+	})
+}
+
+// addPath starts monitoring the path in the body, ?persist=true also adds it to the config file
+func (a *api) addPath(w http.ResponseWriter, r *http.Request) {
+	var p config.Path
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&p); err != nil {
+		a.error(w, http.StatusBadRequest, "invalid path: "+err.Error())
+		return
+	}
+
+	if err := p.Validate(); err != nil {
+		a.error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := a.reload.addPath(p, persist(r)); err != nil {
+		a.error(w, pathErrorStatus(err), err.Error())
+		return
+	}
+
+	for _, status := range a.mon.Paths() {
+		if status.Path == p.Path {
+			a.write(w, http.StatusCreated, status)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// removePath stops monitoring ?path=, ?persist=true also removes it from the config file
+func (a *api) removePath(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		a.error(w, http.StatusBadRequest, "path must not be empty")
+		return
+	}
+
+	if err := a.reload.removePath(path, persist(r)); err != nil {
+		a.error(w, pathErrorStatus(err), err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// events lists the most recent events, filtered by ?prefix=, ?op= (repeatable), ?since= and
+// ?until= (RFC 3339) and ?limit=
+func (a *api) events(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := monitor.EventFilter{
+		Prefix: query.Get("prefix"),
+		Ops:    query["op"],
+	}
+
+	var err error
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := query.Get(name); v != "" {
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				a.error(w, http.StatusBadRequest, "invalid "+name+": "+err.Error())
+				return
+			}
+		}
+	}
+
+	if v := query.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			a.error(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	a.write(w, http.StatusOK, map[string]interface{}{
+		"events": a.mon.Events(filter),
+	})
+}
+
+// files lists every tracked file, optionally only the ones whose path starts with ?prefix=
+func (a *api) files(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+
+	files := []monitor.FileStatus{}
+	for _, f := range a.mon.Files() {
+		if strings.HasPrefix(f.Path, prefix) {
+			files = append(files, f)
+		}
+	}
+
+	a.write(w, http.StatusOK, map[string]interface{}{
+		"files": files,
+	})
+}
+
+// file returns a single tracked file, the path is taken as absolute
+func (a *api) file(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+
+	f, ok := a.mon.File("/" + path)
+	if !ok {
+		// paths that are not rooted at / such as windows drives
+		f, ok = a.mon.File(path)
+	}
+
+	if !ok {
+		a.error(w, http.StatusNotFound, "file is not tracked")
+		return
+	}
+
+	a.write(w, http.StatusOK, f)
+}
+
+// authenticated only lets requests bearing the api token through
+func (a *api) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.token == "" {
+			a.error(w, http.StatusForbidden, "path management is disabled, start with --api.token")
+			return
+		}
+
+		if !validToken(r, a.token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			a.error(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func persist(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("persist"))
+	return v
+}
+
+// pathErrorStatus maps an error adding or removing a path to a status code
+func pathErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, monitor.ErrPathMonitored):
+		return http.StatusConflict
+	case errors.Is(err, monitor.ErrPathNotMonitored):
+		return http.StatusNotFound
+	case errors.Is(err, errNoConfigFile):
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+func (a *api) error(w http.ResponseWriter, status int, message string) {
+	a.write(w, status, map[string]string{
+		"error": message,
+	})
+}
+
+func (a *api) write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.log.WithError(err).Debug("unable to write api response")
+	}
+}
@@ -0,0 +1,412 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+func TestAPI(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+
+	for _, name := range []string{"a/one", "a/two", "b/three"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	mon, err := monitor.New(monitor.Options{
+		Config: &config.Config{
+			Paths: []config.Path{
+				{Path: filepath.Join(dir, "a")},
+				{Path: filepath.Join(dir, "b")},
+				{Path: missing},
+			},
+		},
+		Registerer: prometheus.NewRegistry(),
+		Logger:     log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mon.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer mon.Stop()
+
+	handler, err := newAPI(context.Background(), log, mon, nil, "", prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	handler.register(router)
+
+	slash := func(name string) string {
+		return filepath.ToSlash(filepath.Join(dir, name))
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+
+		// paths and files are the paths expected in the response, sorted
+		paths []string
+		files []string
+		file  string
+	}{
+		{
+			name:   "paths",
+			url:    "/api/v1/paths",
+			status: http.StatusOK,
+			paths:  []string{filepath.Join(dir, "a"), filepath.Join(dir, "b"), missing},
+		},
+		{
+			name:   "files",
+			url:    "/api/v1/files",
+			status: http.StatusOK,
+			files:  []string{slash("a/one"), slash("a/two"), slash("b/three")},
+		},
+		{
+			name:   "files with a prefix",
+			url:    "/api/v1/files?prefix=" + slash("a/"),
+			status: http.StatusOK,
+			files:  []string{slash("a/one"), slash("a/two")},
+		},
+		{
+			name:   "files with an unknown prefix",
+			url:    "/api/v1/files?prefix=" + slash("c/"),
+			status: http.StatusOK,
+			files:  []string{},
+		},
+		{
+			name:   "file",
+			url:    "/api/v1/files" + slash("b/three"),
+			status: http.StatusOK,
+			file:   slash("b/three"),
+		},
+		{
+			name:   "file that is not tracked",
+			url:    "/api/v1/files" + slash("b/four"),
+			status: http.StatusNotFound,
+		},
+	}
+
+	// files are tracked once the initial scan has stat'ed them
+	for deadline := time.Now().Add(5 * time.Second); len(mon.Files()) < 3; {
+		if time.Now().After(deadline) {
+			t.Fatalf("tracking %d files, want 3", len(mon.Files()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("content type %q", ct)
+			}
+
+			var body struct {
+				Paths []monitor.PathStatus `json:"paths"`
+				Files []monitor.FileStatus `json:"files"`
+				Path  string               `json:"path"`
+				Error string               `json:"error"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			switch {
+			case tt.status != http.StatusOK:
+				if body.Error == "" {
+					t.Fatal("no error in the response")
+				}
+			case tt.paths != nil:
+				var got []string
+				for _, p := range body.Paths {
+					got = append(got, p.Path)
+
+					want := monitor.PathActive
+					if p.Path == missing {
+						want = monitor.PathPending
+					}
+					if p.State != want {
+						t.Errorf("%s is %s, want %s", p.Path, p.State, want)
+					}
+				}
+
+				if !reflect.DeepEqual(got, tt.paths) {
+					t.Fatalf("paths %v, want %v", got, tt.paths)
+				}
+			case tt.files != nil:
+				got := []string{}
+				for _, f := range body.Files {
+					got = append(got, f.Path)
+				}
+				sort.Strings(got)
+
+				if !reflect.DeepEqual(got, tt.files) {
+					t.Fatalf("files %v, want %v", got, tt.files)
+				}
+			default:
+				if body.Path != tt.file {
+					t.Fatalf("file %q, want %q", body.Path, tt.file)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIManagePaths(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+
+	a, b, c := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")
+	for _, path := range []string{a, b, c} {
+		if err := os.Mkdir(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(file, []byte("paths:\n  - path: "+a+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := newTestContext(t, "--config", file)
+
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	mon, err := monitor.New(monitor.Options{
+		Config:     cfg,
+		Registerer: prometheus.NewRegistry(),
+		Logger:     log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mon.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer mon.Stop()
+
+	reload := newReloader(ctx, log, mon, "secret")
+	handler, err := newAPI(context.Background(), log, mon, reload, "secret", prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	handler.register(router)
+
+	steps := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		token  string
+		reload bool
+		status int
+
+		// monitored are the paths monitored afterwards, saved the ones in the config file
+		monitored []string
+		saved     []string
+	}{
+		{
+			name:      "disabled without a token",
+			method:    http.MethodPost,
+			url:       "/api/v1/paths",
+			body:      `{"path": "` + b + `"}`,
+			status:    http.StatusForbidden,
+			monitored: []string{a},
+			saved:     []string{a},
+		},
+		{
+			name:      "wrong token",
+			method:    http.MethodPost,
+			url:       "/api/v1/paths",
+			body:      `{"path": "` + b + `"}`,
+			token:     "guess",
+			status:    http.StatusUnauthorized,
+			monitored: []string{a},
+			saved:     []string{a},
+		},
+		{
+			name:      "invalid body",
+			method:    http.MethodPost,
+			url:       "/api/v1/paths",
+			body:      `{"path": "` + b + `", "unknown": true}`,
+			token:     "secret",
+			status:    http.StatusBadRequest,
+			monitored: []string{a},
+			saved:     []string{a},
+		},
+		{
+			name:      "invalid path",
+			method:    http.MethodPost,
+			url:       "/api/v1/paths",
+			body:      `{"path": ""}`,
+			token:     "secret",
+			status:    http.StatusBadRequest,
+			monitored: []string{a},
+			saved:     []string{a},
+		},
+		{
+			name:      "added",
+			method:    http.MethodPost,
+			url:       "/api/v1/paths",
+			body:      `{"path": "` + b + `"}`,
+			token:     "secret",
+			status:    http.StatusCreated,
+			monitored: []string{a, b},
+			saved:     []string{a},
+		},
+		{
+			name:      "already monitored",
+			method:    http.MethodPost,
+			url:       "/api/v1/paths",
+			body:      `{"path": "` + b + `"}`,
+			token:     "secret",
+			status:    http.StatusConflict,
+			monitored: []string{a, b},
+			saved:     []string{a},
+		},
+		{
+			name:      "kept across reloads",
+			reload:    true,
+			monitored: []string{a, b},
+			saved:     []string{a},
+		},
+		{
+			name:      "added and persisted",
+			method:    http.MethodPost,
+			url:       "/api/v1/paths?persist=true",
+			body:      `{"path": "` + c + `", "recursive": true}`,
+			token:     "secret",
+			status:    http.StatusCreated,
+			monitored: []string{a, b, c},
+			saved:     []string{a, c},
+		},
+		{
+			name:      "removed and persisted",
+			method:    http.MethodDelete,
+			url:       "/api/v1/paths?persist=true&path=" + a,
+			token:     "secret",
+			status:    http.StatusNoContent,
+			monitored: []string{b, c},
+			saved:     []string{c},
+		},
+		{
+			name:      "removal kept across reloads",
+			reload:    true,
+			monitored: []string{b, c},
+			saved:     []string{c},
+		},
+		{
+			name:      "not monitored",
+			method:    http.MethodDelete,
+			url:       "/api/v1/paths?path=" + a,
+			token:     "secret",
+			status:    http.StatusNotFound,
+			monitored: []string{b, c},
+			saved:     []string{c},
+		},
+		{
+			name:      "removal without a path",
+			method:    http.MethodDelete,
+			url:       "/api/v1/paths",
+			token:     "secret",
+			status:    http.StatusBadRequest,
+			monitored: []string{b, c},
+			saved:     []string{c},
+		},
+	}
+
+	for _, step := range steps {
+		if step.reload {
+			if err := reload.reload(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		} else {
+			handler.token = ""
+			if step.status != http.StatusForbidden {
+				handler.token = "secret"
+			}
+
+			req := httptest.NewRequest(step.method, step.url, strings.NewReader(step.body))
+			if step.token != "" {
+				req.Header.Set("Authorization", "Bearer "+step.token)
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != step.status {
+				t.Fatalf("%s: status %d, want %d: %s", step.name, rec.Code, step.status, rec.Body)
+			}
+		}
+
+		var monitored []string
+		for _, p := range mon.Paths() {
+			monitored = append(monitored, p.Path)
+		}
+		sort.Strings(monitored)
+
+		if !reflect.DeepEqual(monitored, step.monitored) {
+			t.Fatalf("%s: monitoring %v, want %v", step.name, monitored, step.monitored)
+		}
+
+		saved, err := config.Load(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var savedPaths []string
+		for _, p := range saved.Paths {
+			savedPaths = append(savedPaths, p.Path)
+		}
+
+		if !reflect.DeepEqual(savedPaths, step.saved) {
+			t.Fatalf("%s: config file has %v, want %v", step.name, savedPaths, step.saved)
+		}
+	}
+}
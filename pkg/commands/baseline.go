@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"crypto/ed25519"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	"github.com/sans-sroc/file_exporter/pkg/baseline"
+	"github.com/sans-sroc/file_exporter/pkg/common"
+	"github.com/sans-sroc/file_exporter/pkg/signing"
+)
+
+type baselineCommand struct{}
+
+func (b *baselineCommand) Execute(c *cli.Context) error {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+
+	var key ed25519.PrivateKey
+	if c.String("key-file") != "" {
+		if key, err = signing.LoadPrivateKey(c.String("key-file")); err != nil {
+			return err
+		}
+	}
+
+	log := logrus.StandardLogger()
+
+	manifest, err := baseline.Create(cfg, log)
+	if err != nil {
+		return err
+	}
+
+	output := c.String("output")
+	if err := baseline.Write(output, manifest, key); err != nil {
+		return err
+	}
+
+	entry := log.WithField("output", output).WithField("files", len(manifest.Files))
+	if key != nil {
+		entry = entry.WithField("signature", output+baseline.SignatureSuffix).WithField("key_id", signing.KeyID(key.Public().(ed25519.PublicKey)))
+	}
+
+	entry.Info("wrote baseline")
+
+	return nil
+}
+
+func init() {
+	cmd := baselineCommand{}
+
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:    "output",
+			Usage:   "File the manifest is written to",
+			Aliases: []string{"o"},
+			EnvVars: []string{"BASELINE_OUTPUT"},
+			Value:   "baseline.json",
+		},
+		&cli.StringFlag{
+			Name:    "key-file",
+			Usage:   "ed25519 private key (PKCS #8 PEM) the manifest is signed with, the signature is written next to it with a .sig suffix",
+			EnvVars: []string{"BASELINE_KEY_FILE"},
+		},
+	}
+
+	flags = append(flags, pathFlags()...)
+
+	cliCmd := &cli.Command{
+		Name:   "baseline",
+		Usage:  "write the SHA-256, size, mode, owner and modification time of every monitored file to a manifest",
+		Action: cmd.Execute,
+		Flags:  append(flags, globalFlags()...),
+		Before: globalBefore,
+	}
+
+	common.RegisterCommand(cliCmd)
+}
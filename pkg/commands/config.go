@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+// loadConfig reads the config file (when given) and merges the path flags into it,
+// flag values act as the defaults for any rule in the file that does not set its own
+func loadConfig(c *cli.Context) (*config.Config, error) {
+	cfg := &config.Config{}
+
+	if c.String("config") != "" {
+		var err error
+		cfg, err = config.Load(c.String("config"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.String("rootfs") != "" {
+		cfg.RootFS = c.String("rootfs")
+	}
+
+	if c.IsSet("stat-metrics") {
+		cfg.StatMetrics = c.StringSlice("stat-metrics")
+	}
+
+	if c.IsSet("hash-workers") || cfg.HashWorkers == 0 {
+		cfg.HashWorkers = c.Int("hash-workers")
+	}
+
+	if c.IsSet("hash-bytes-per-second") {
+		cfg.HashBytesPerSecond = c.Int64("hash-bytes-per-second")
+	}
+
+	if c.IsSet("state-file") {
+		cfg.StateFile = c.String("state-file")
+	}
+
+	if c.IsSet("audit-log") {
+		cfg.AuditLog.Path = c.String("audit-log")
+	}
+
+	if c.IsSet("journal.path") {
+		cfg.Journal.Path = c.String("journal.path")
+	}
+
+	if c.IsSet("journal.key-file") {
+		cfg.Journal.KeyFile = c.String("journal.key-file")
+	}
+
+	if c.IsSet("max-tracked-files") {
+		cfg.MaxTrackedFiles = c.Int("max-tracked-files")
+	}
+
+	if c.IsSet("event-history") || cfg.EventHistory == 0 {
+		cfg.EventHistory = c.Int("event-history")
+	}
+
+	if c.IsSet("rehash-interval") {
+		cfg.RehashInterval.Duration = c.Duration("rehash-interval")
+	}
+
+	if c.Bool("legacy-modified-time") {
+		cfg.LegacyModifiedTime = true
+	}
+
+	if c.IsSet("backend") || cfg.Backend == "" {
+		cfg.Backend = c.String("backend")
+	}
+
+	paths := c.StringSlice("path")
+	if len(c.String("paths")) > 0 {
+		paths = append(paths, strings.Split(c.String("paths"), ",")...)
+	}
+
+	recursivePaths := c.StringSlice("recursive-path")
+	if len(c.String("recursive-paths")) > 0 {
+		recursivePaths = append(recursivePaths, strings.Split(c.String("recursive-paths"), ",")...)
+	}
+
+	for _, p := range paths {
+		cfg.Paths = append(cfg.Paths, config.Path{Path: p})
+	}
+
+	for _, p := range recursivePaths {
+		cfg.Paths = append(cfg.Paths, config.Path{Path: p, Recursive: true})
+	}
+
+	cfg.ApplyDefaults(pathDefaults(c))
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// pathDefaults returns the per path settings given as flags
+func pathDefaults(c *cli.Context) config.Path {
+	return config.Path{
+		Regex:         c.String("regex"),
+		RegexFullPath: c.Bool("regex-full-path"),
+		Hash:          c.String("hash"),
+		Interval:      config.Duration{Duration: c.Duration("interval")},
+	}
+}
+
+// pathFlags are the flags that select the files to monitor
+func pathFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "path",
+			Usage:   "Path to monitor, will not be recursive",
+			Aliases: []string{"p"},
+			EnvVars: []string{"SINGLE_PATH"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "recursive-path",
+			Usage:   "Path to monitor with recursion",
+			Aliases: []string{"rp"},
+			EnvVars: []string{"RECURSIVE_PATH"},
+		},
+		&cli.StringFlag{
+			Name:    "paths",
+			Usage:   "Paths to monitor, comma separated (will not be recursive)",
+			EnvVars: []string{"PATHS"},
+			Hidden:  true,
+		},
+		&cli.StringFlag{
+			Name:    "recursive-paths",
+			Usage:   "Paths to monitor recursively, comma separated (will not be recursive)",
+			EnvVars: []string{"RECURSIVE_PATHS"},
+			Hidden:  true,
+		},
+		&cli.StringFlag{
+			Name:    "rootfs",
+			Usage:   "Location of the root fs",
+			EnvVars: []string{"ROOTFS"},
+		},
+		&cli.StringFlag{
+			Name:    "regex",
+			Usage:   "Only files that match the regular expression during file listings",
+			EnvVars: []string{"REGEX"},
+		},
+		&cli.BoolFlag{
+			Name:    "regex-full-path",
+			Aliases: []string{"regex-fullpath"},
+			Usage:   "Whether or not the regex applies against the filename or the full path",
+			EnvVars: []string{"REGEX_FULL_PATH", "REGEX_FULLPATH"},
+		},
+	}
+}
@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/sans-sroc/file_exporter/pkg/common"
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/journal"
+	"github.com/sans-sroc/file_exporter/pkg/signing"
+)
+
+type journalVerifyCommand struct{}
+
+// exitUnsigned is the exit code of a verification whose chain is intact but ends with events that
+// should have been signed already
+const exitUnsigned = 2
+
+func (j *journalVerifyCommand) Execute(c *cli.Context) error {
+	path := c.Args().First()
+	signInterval := journal.DefaultSignInterval
+
+	if c.String("config") != "" {
+		cfg, err := config.Load(c.String("config"))
+		if err != nil {
+			return err
+		}
+
+		if path == "" {
+			path = cfg.Journal.Path
+		}
+
+		if cfg.Journal.SignInterval.Duration != 0 {
+			signInterval = cfg.Journal.SignInterval.Duration
+		}
+	}
+
+	if c.IsSet("sign-interval") {
+		signInterval = c.Duration("sign-interval")
+	}
+
+	if path == "" {
+		return errors.New("the journal to verify must be given as an argument or in the journal section of --config")
+	}
+
+	// anyone who can write the journal can rewrite the chain, only the signatures prove it was not
+	if c.String("public-key") == "" {
+		return errors.New("--public-key is required, the hash chain alone does not prove the journal was not rewritten")
+	}
+
+	key, err := signing.LoadPublicKey(c.String("public-key"))
+	if err != nil {
+		return err
+	}
+
+	var anchor *journal.Anchor
+	if c.IsSet("expect-seq") || c.IsSet("expect-head") {
+		anchor = &journal.Anchor{Seq: c.Uint64("expect-seq"), Head: c.String("expect-head")}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := journal.Verify(file, key, anchor)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("journal:    %s\n", path)
+	fmt.Printf("records:    %d (%d events, %d signatures)\n", report.Records, report.Events, report.Signatures)
+	fmt.Printf("key:        %s\n", signing.KeyID(key))
+	fmt.Printf("signed:     up to seq %d\n", report.Signed)
+	fmt.Printf("unsigned:   %d events\n", report.Unsigned)
+
+	fmt.Printf("head:       %s (seq %d)\n", report.Head, report.Records)
+
+	if report.Broken != nil {
+		fmt.Printf("broken:     %s\n", report.Broken)
+		return cli.Exit("the journal is broken", 1)
+	}
+
+	if report.Signatures == 0 && report.Records > 0 {
+		return cli.Exit("the journal holds no signature", 1)
+	}
+
+	// the last events are signed within a sign interval while the exporter runs
+	if report.Unsigned > 0 && time.Since(report.UnsignedSince) > signInterval {
+		fmt.Printf("unsigned since %s, the sign interval is %s\n", report.UnsignedSince.Format(time.RFC3339), signInterval)
+		return cli.Exit("the chain is intact but its last events are not signed", exitUnsigned)
+	}
+
+	fmt.Println("the chain is intact")
+
+	if anchor == nil {
+		fmt.Println("records removed from the end are only detected with --expect-seq or --expect-head")
+	}
+
+	return nil
+}
+
+func init() {
+	verify := journalVerifyCommand{}
+
+	cliCmd := &cli.Command{
+		Name:  "journal",
+		Usage: "tamper evident journal of events",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "verify",
+				Usage:     "walk the chain of a journal and report the first broken link",
+				ArgsUsage: "[journal]",
+				Action:    verify.Execute,
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:    "public-key",
+						Usage:   "ed25519 public key (PEM) the signatures are checked against, required",
+						EnvVars: []string{"JOURNAL_PUBLIC_KEY"},
+					},
+					&cli.DurationFlag{
+						Name:  "sign-interval",
+						Usage: "time after which unsigned events make the verification fail, defaults to journal.sign_interval of --config or 1m",
+					},
+					&cli.Uint64Flag{
+						Name:  "expect-seq",
+						Usage: "seq of a record the journal must hold, as printed by a previous verification and kept elsewhere",
+					},
+					&cli.StringFlag{
+						Name:  "expect-head",
+						Usage: "hash of the record given by --expect-seq, or of any record without it",
+					},
+				}, globalFlags()...),
+				Before: globalBefore,
+			},
+		},
+	}
+
+	common.RegisterCommand(cliCmd)
+}
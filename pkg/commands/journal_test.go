@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/urfave/cli/v2"
+
+	"github.com/sans-sroc/file_exporter/pkg/common"
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/journal"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// writePEM writes a key to a PEM file in dir and returns its path
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// verifyJournal runs journal verify with args
+func verifyJournal(t *testing.T, args ...string) error {
+	t.Helper()
+
+	set := flag.NewFlagSet("verify", flag.ContinueOnError)
+
+	for _, cmd := range common.GetCommands() {
+		if cmd.Name != "journal" {
+			continue
+		}
+
+		for _, f := range cmd.Subcommands[0].Flags {
+			if err := f.Apply(set); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := journalVerifyCommand{}
+
+	return verify.Execute(cli.NewContext(cli.NewApp(), set, nil))
+}
+
+func TestJournalVerify(t *testing.T) {
+	dir := t.TempDir()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := writePEM(t, dir, "journal.key", "PRIVATE KEY", privateDER)
+	publicKey := writePEM(t, dir, "journal.pub", "PUBLIC KEY", publicDER)
+
+	path := filepath.Join(dir, "journal.jsonl")
+
+	j, err := journal.New(config.Journal{
+		Path:         path,
+		KeyFile:      keyFile,
+		SignInterval: config.Duration{Duration: time.Hour},
+	}, journal.Options{Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := j.Record(monitor.Event{Time: time.Now(), Op: "WRITE", Path: "/etc/passwd"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the events are signed when the journal is closed
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := filepath.Join(dir, "changed.jsonl")
+	if err := os.WriteFile(changed, []byte(strings.Replace(string(data), "/etc/passwd", "/etc/shadow", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+
+		// err is part of the error, code the exit code when it is one, 0 when the journal verifies
+		err  string
+		code int
+	}{
+		{
+			name: "intact",
+			args: []string{"--public-key", publicKey, path},
+		},
+		{
+			name: "without public key",
+			args: []string{path},
+			err:  "--public-key is required",
+		},
+		{
+			name: "changed",
+			args: []string{"--public-key", publicKey, changed},
+			err:  "the journal is broken",
+			code: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyJournal(t, tt.args...)
+
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error %v, want %q", err, tt.err)
+			}
+
+			var exit cli.ExitCoder
+			if tt.code != 0 && (!errors.As(err, &exit) || exit.ExitCode() != tt.code) {
+				t.Fatalf("error %v, want exit code %d", err, tt.code)
+			}
+		})
+	}
+}
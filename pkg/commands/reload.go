@@ -0,0 +1,231 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+var errNoConfigFile = errors.New("paths can only be persisted when started with --config")
+
+var (
+	configLastReloadSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "file_exporter_config_last_reload_success",
+		Help: "Whether the last configuration reload attempt was successful",
+	})
+
+	configLastReloadSuccessTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "file_exporter_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration reload",
+	})
+)
+
+type reloader struct {
+	mu  sync.Mutex
+	c   *cli.Context
+	log *logrus.Entry
+	mon *monitor.Monitor
+
+	// token authenticates reloads over http, they are disabled without one
+	token string
+
+	// added and removed are the paths changed at runtime, they are applied on top of the
+	// configuration on every reload so they survive it
+	added   []config.Path
+	removed map[string]bool
+}
+
+func newReloader(c *cli.Context, log *logrus.Logger, mon *monitor.Monitor, token string) *reloader {
+	configLastReloadSuccess.Set(1)
+	configLastReloadSuccessTimestamp.SetToCurrentTime()
+
+	return &reloader{
+		c:     c,
+		log:   log.WithField("component", "reload"),
+		mon:   mon,
+		token: token,
+
+		removed: map[string]bool{},
+	}
+}
+
+// reload re-reads the configuration file and flags and applies them to the monitor
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := loadConfig(r.c)
+	if err == nil {
+		r.applyRuntime(cfg)
+		err = r.mon.Reload(cfg)
+	}
+
+	if err != nil {
+		configLastReloadSuccess.Set(0)
+		r.log.WithError(err).Error("unable to reload configuration")
+		return err
+	}
+
+	configLastReloadSuccess.Set(1)
+	configLastReloadSuccessTimestamp.SetToCurrentTime()
+	r.log.Info("configuration reloaded")
+
+	return nil
+}
+
+// applyRuntime applies the paths added and removed at runtime to a configuration
+func (r *reloader) applyRuntime(cfg *config.Config) {
+	paths := cfg.Paths[:0]
+	for _, p := range cfg.Paths {
+		if !r.removed[p.Path] {
+			paths = append(paths, p)
+		}
+	}
+
+	for _, p := range r.added {
+		if !slices.ContainsFunc(paths, func(q config.Path) bool { return q.Path == p.Path }) {
+			p.ApplyDefaults(pathDefaults(r.c))
+			paths = append(paths, p)
+		}
+	}
+
+	cfg.Paths = paths
+}
+
+// addPath starts monitoring a path at runtime, with persist it is also added to the config file
+func (r *reloader) addPath(p config.Path, persist bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if persist && r.c.String("config") == "" {
+		return errNoConfigFile
+	}
+
+	added := p
+	added.ApplyDefaults(pathDefaults(r.c))
+
+	if err := r.mon.AddPath(added); err != nil {
+		return err
+	}
+
+	delete(r.removed, p.Path)
+	r.added = append(removePath(r.added, p.Path), p)
+
+	if !persist {
+		return nil
+	}
+
+	return r.persist(func(cfg *config.Config) {
+		if !slices.ContainsFunc(cfg.Paths, func(q config.Path) bool { return q.Path == p.Path }) {
+			cfg.Paths = append(cfg.Paths, p)
+		}
+	})
+}
+
+// removePath stops monitoring a path at runtime, with persist it is also removed from the config
+// file. A path given as a flag can only be removed until the process restarts.
+func (r *reloader) removePath(path string, persist bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if persist && r.c.String("config") == "" {
+		return errNoConfigFile
+	}
+
+	if err := r.mon.RemovePath(path); err != nil {
+		return err
+	}
+
+	r.added = removePath(r.added, path)
+	r.removed[path] = true
+
+	if !persist {
+		return nil
+	}
+
+	return r.persist(func(cfg *config.Config) {
+		cfg.Paths = removePath(cfg.Paths, path)
+	})
+}
+
+// persist applies fn to the config file as it is on disk, without the flags merged in
+func (r *reloader) persist(fn func(cfg *config.Config)) error {
+	file := r.c.String("config")
+
+	cfg, err := config.Load(file)
+	if err != nil {
+		return err
+	}
+
+	fn(cfg)
+
+	if err := config.Save(file, cfg); err != nil {
+		return fmt.Errorf("unable to save config file %s: %w", file, err)
+	}
+
+	r.log.WithField("config", file).Info("saved paths to config file")
+
+	return nil
+}
+
+func removePath(paths []config.Path, path string) []config.Path {
+	kept := make([]config.Path, 0, len(paths))
+	for _, p := range paths {
+		if p.Path != path {
+			kept = append(kept, p)
+		}
+	}
+
+	return kept
+}
+
+// watchSignal reloads the configuration whenever the process receives SIGHUP
+func (r *reloader) watchSignal(ctx context.Context) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ch:
+			r.log.Info("received SIGHUP")
+			_ = r.reload()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.token == "" {
+		http.Error(w, "reloading over http is disabled, start with --api.token", http.StatusForbidden)
+		return
+	}
+
+	if !validToken(req, r.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.reload(); err != nil {
+		http.Error(w, "failed to reload config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	"github.com/sans-sroc/file_exporter/pkg/common"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// newTestContext parses args with the flags of the server command
+func newTestContext(t *testing.T, args ...string) *cli.Context {
+	t.Helper()
+
+	set := flag.NewFlagSet("server", flag.ContinueOnError)
+
+	for _, cmd := range common.GetCommands() {
+		if cmd.Name != "server" {
+			continue
+		}
+
+		for _, f := range cmd.Flags {
+			if err := f.Apply(set); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+func TestReloadHandler(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "config.yaml")
+	valid := []byte("paths:\n  - path: " + dir + "\n")
+
+	if err := os.WriteFile(file, valid, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestContext(t, "--config", file)
+
+	cfg, err := loadConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	mon, err := monitor.New(monitor.Options{
+		Config:     cfg,
+		Logger:     log,
+		Registerer: prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newReloader(c, log, mon, "secret")
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		config        []byte
+		status        int
+		success       float64
+	}{
+		{
+			name:    "disabled without a token",
+			config:  valid,
+			status:  http.StatusForbidden,
+			success: 1,
+		},
+		{
+			name:    "missing token",
+			token:   "secret",
+			config:  valid,
+			status:  http.StatusUnauthorized,
+			success: 1,
+		},
+		{
+			name:          "token without the bearer scheme",
+			token:         "secret",
+			authorization: "secret",
+			config:        valid,
+			status:        http.StatusUnauthorized,
+			success:       1,
+		},
+		{
+			name:          "wrong token",
+			token:         "secret",
+			authorization: "Bearer guess",
+			config:        valid,
+			status:        http.StatusUnauthorized,
+			success:       1,
+		},
+		{
+			name:          "invalid config",
+			token:         "secret",
+			authorization: "Bearer secret",
+			config:        []byte("paths: [\n"),
+			status:        http.StatusInternalServerError,
+			success:       0,
+		},
+		{
+			name:          "rejected requests leave the gauge alone",
+			token:         "secret",
+			authorization: "Bearer guess",
+			config:        valid,
+			status:        http.StatusUnauthorized,
+			success:       0,
+		},
+		{
+			name:          "reloaded",
+			token:         "secret",
+			authorization: "Bearer secret",
+			config:        valid,
+			status:        http.StatusOK,
+			success:       1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(file, tt.config, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			r.token = tt.token
+
+			req := httptest.NewRequest(http.MethodPost, "/-/reload", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			if got := testutil.ToFloat64(configLastReloadSuccess); got != tt.success {
+				t.Fatalf("file_exporter_config_last_reload_success is %v, want %v", got, tt.success)
+			}
+		})
+	}
+}
@@ -2,18 +2,20 @@ package commands
 
 import (
 	"context"
-	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rancher/wrangler/pkg/signals"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
 	"github.com/sans-sroc/file_exporter/pkg/common"
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
 	"github.com/sans-sroc/file_exporter/pkg/monitor"
 )
 
@@ -24,13 +26,9 @@ type apiServerCommand struct{}
 func (s *apiServerCommand) Execute(c *cli.Context) error {
 	ctx := signals.SetupSignalHandler(context.Background())
 
-	p1 := c.StringSlice("path")
-	p2 := c.StringSlice("recursive-path")
-	p3 := strings.Split(c.String("paths"), ",")
-	p4 := strings.Split(c.String("recursive-paths"), ",")
-
-	if len(p1) == 0 && len(p2) == 0 && len(p3) == 0 && len(p4) == 0 {
-		return errors.New("either a path or path-recursive to the tool for monitoring")
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
 	}
 
 	globalLevel := logrus.GetLevel()
@@ -43,24 +41,59 @@ func (s *apiServerCommand) Execute(c *cli.Context) error {
 		return err
 	}
 
-	go monitor.New(serviceCtx, c, log)
+	token, err := apiToken(c)
+	if err != nil {
+		return err
+	}
+
+	recorders, closeRecorders, err := newRecorders(cfg, log)
+	if err != nil {
+		return err
+	}
+	defer closeRecorders()
+
+	mon, err := monitor.New(monitor.Options{
+		Config:    cfg,
+		Logger:    log,
+		Recorders: recorders,
+	})
+	if err != nil {
+		return err
+	}
+
+	sinkList, err := newSinks(serviceCtx, cfg, log)
+	if err != nil {
+		return err
+	}
+
+	waitSinks := startSinks(mon, sinkList)
+
+	go func() {
+		if err := mon.Start(serviceCtx); err != nil {
+			log.WithError(err).Error("unable to start monitor")
+		}
+	}()
+
+	reload := newReloader(c, log, mon, token)
+	go reload.watchSignal(serviceCtx)
 
 	listen := c.String("telemetry.addr")
 	entry := log.WithField("component", "metrics").WithField("telemetry.addr", listen)
 
-	router := mux.NewRouter().StrictSlash(true)
-	router.Path("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, _ = w.Write([]byte(`<html>
-<head><title>file_exporter</title></head>
-<body>
-<h1>file_exporter</h1>
-<p><a href="` + c.String("telemetry.path") + `">Metrics</a></p>
-<p><i>` + common.AppVersion.Summary + `</i></p>
-</body>
-</html>`))
-	})
+	metricsPath := c.String("telemetry.path")
+	if !strings.HasPrefix(metricsPath, "/") {
+		metricsPath = "/" + metricsPath
+	}
 
-	router.Path("/metrics").Handler(promhttp.Handler())
+	router := mux.NewRouter().StrictSlash(true)
+	router.Path(metricsPath).Handler(promhttp.Handler())
+	router.Path("/").Handler(&statusHandler{log: log, mon: mon, metricsPath: metricsPath})
+	handler, err := newAPI(serviceCtx, log, mon, reload, token, prometheus.DefaultRegisterer)
+	if err != nil {
+		return err
+	}
+	handler.register(router)
+	router.Path("/-/reload").Methods(http.MethodPost, http.MethodPut).Handler(reload)
 
 	srv := &http.Server{
 		Addr:    listen,
@@ -87,6 +120,9 @@ func (s *apiServerCommand) Execute(c *cli.Context) error {
 		entry.Fatalf("Could not gracefully shutdown the metrics server: %v\n", err)
 	}
 
+	mon.Stop()
+	waitSinks()
+
 	return nil
 }
 
@@ -106,47 +142,97 @@ func init() {
 			EnvVars: []string{"TELEMETRY_PATH"},
 			Value:   "/metrics",
 		},
-		&cli.StringSliceFlag{
-			Name:    "path",
-			Usage:   "Path to monitor, will not be recursive",
-			Aliases: []string{"p"},
-			EnvVars: []string{"SINGLE_PATH"},
+		&cli.StringFlag{
+			Name:    "api.token",
+			Usage:   "Bearer token required to reload the configuration over http and to add and remove paths through the API, both are disabled without one",
+			EnvVars: []string{"API_TOKEN"},
 		},
-		&cli.StringSliceFlag{
-			Name:    "recursive-path",
-			Usage:   "Path to monitor with recursion",
-			Aliases: []string{"rp"},
-			EnvVars: []string{"RECURSIVE_PATH"},
+		&cli.StringFlag{
+			Name:    "api.token-file",
+			Usage:   "File containing the bearer token required to reload the configuration and to manage paths over http",
+			EnvVars: []string{"API_TOKEN_FILE"},
+		},
+	}
+
+	flags = append(flags, pathFlags()...)
+
+	flags = append(flags, []cli.Flag{
+		&cli.DurationFlag{
+			Name:    "interval",
+			Usage:   "How often paths are polled for changes, can be overridden per path in the config file",
+			EnvVars: []string{"INTERVAL"},
+			Value:   config.DefaultInterval,
 		},
 		&cli.StringFlag{
-			Name:    "paths",
-			Usage:   "Paths to monitor, comma separated (will not be recursive)",
-			EnvVars: []string{"PATHS"},
-			Hidden:  true,
+			Name:    "hash",
+			Usage:   "Hash algorithm for file contents: " + strings.Join(hasher.Supported(), ", ") + ", can be overridden per path in the config file",
+			EnvVars: []string{"HASH"},
+			Value:   config.DefaultHash,
+		},
+		&cli.IntFlag{
+			Name:    "hash-workers",
+			Usage:   "Number of files hashed concurrently",
+			EnvVars: []string{"HASH_WORKERS"},
+			Value:   4,
+		},
+		&cli.Int64Flag{
+			Name:    "hash-bytes-per-second",
+			Usage:   "Limits the combined read throughput of the hash workers (0 is unlimited)",
+			EnvVars: []string{"HASH_BYTES_PER_SECOND"},
 		},
 		&cli.StringFlag{
-			Name:    "recursive-paths",
-			Usage:   "Paths to monitor recursively, comma separated (will not be recursive)",
-			EnvVars: []string{"RECURSIVE_PATHS"},
-			Hidden:  true,
+			Name:    "state-file",
+			Usage:   "File the state of every monitored file is saved to, changes made while the exporter was not running are reported at startup",
+			EnvVars: []string{"STATE_FILE"},
 		},
 		&cli.StringFlag{
-			Name:    "rootfs",
-			Usage:   "Location of the root fs",
-			EnvVars: []string{"ROOTFS"},
+			Name:    "audit-log",
+			Usage:   "JSON Lines file every event is appended to, see audit_log in the config file for rotation",
+			EnvVars: []string{"AUDIT_LOG"},
 		},
 		&cli.StringFlag{
-			Name:    "regex",
-			Usage:   "Only files that match the regular expression during file listings",
-			EnvVars: []string{"REGEX"},
+			Name:    "journal.path",
+			Usage:   "Hash chained journal every event is appended to, the head of the chain is signed with --journal.key-file",
+			EnvVars: []string{"JOURNAL_PATH"},
+		},
+		&cli.StringFlag{
+			Name:    "journal.key-file",
+			Usage:   "ed25519 private key (PKCS #8 PEM) the journal is signed with",
+			EnvVars: []string{"JOURNAL_KEY_FILE"},
+		},
+		&cli.IntFlag{
+			Name:    "max-tracked-files",
+			Usage:   "Bounds the number of files whose state is kept in memory, the least recently updated are evicted first (0 is unlimited)",
+			EnvVars: []string{"MAX_TRACKED_FILES"},
+		},
+		&cli.IntFlag{
+			Name:    "event-history",
+			Usage:   "Number of recent events kept in memory and served on /api/v1/events",
+			EnvVars: []string{"EVENT_HISTORY"},
+			Value:   1000,
+		},
+		&cli.DurationFlag{
+			Name:    "rehash-interval",
+			Usage:   "Files are only re-hashed when their size, times or inode change, this forces a full re-hash once the interval has elapsed (0 disables)",
+			EnvVars: []string{"REHASH_INTERVAL"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "stat-metrics",
+			Usage:   "Optional stat metrics to export: " + strings.Join(config.StatMetrics, ", "),
+			EnvVars: []string{"STAT_METRICS"},
 		},
 		&cli.BoolFlag{
-			Name:    "regex-full-path",
-			Aliases: []string{"regex-fullpath"},
-			Usage:   "Whether or not the regex applies against the filename or the full path",
-			EnvVars: []string{"REGEX_FULL_PATH", "REGEX_FULLPATH"},
+			Name:    "legacy-modified-time",
+			Usage:   "Report the time a change was noticed in file_stat_modified_time_seconds instead of the file's modification time",
+			EnvVars: []string{"LEGACY_MODIFIED_TIME"},
 		},
-	}
+		&cli.StringFlag{
+			Name:    "backend",
+			Usage:   "How changes are detected: poll, inotify, fanotify (requires CAP_SYS_ADMIN) or auto, kernel backends poll any path they cannot watch",
+			EnvVars: []string{"BACKEND"},
+			Value:   config.BackendPoll,
+		},
+	}...)
 
 	cliCmd := &cli.Command{
 		Name:   "server",
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/audit"
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/journal"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+	"github.com/sans-sroc/file_exporter/pkg/sinks"
+)
+
+// sinkBuffer is the number of events a sink may fall behind the monitor before they are dropped,
+// sinks queue events themselves so they only fall behind on bursts
+const sinkBuffer = 4096
+
+// newSinks creates the sinks of the config, deliveries stop when the context is done
+func newSinks(ctx context.Context, cfg *config.Config, log *logrus.Logger) ([]sinks.Sink, error) {
+	opts := sinks.Options{Logger: log}
+
+	var list []sinks.Sink
+
+	for _, w := range cfg.Webhooks {
+		webhook, err := sinks.NewWebhook(ctx, w, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, webhook)
+	}
+
+	for _, l := range cfg.Syslog {
+		server, err := sinks.NewSyslog(l, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, server)
+	}
+
+	return list, nil
+}
+
+// newRecorders creates the recorders of the config, the returned function closes them once the
+// monitor has stopped
+func newRecorders(cfg *config.Config, log *logrus.Logger) ([]monitor.Recorder, func(), error) {
+	var recorders []monitor.Recorder
+	var closers []func() error
+
+	closeAll := func() {
+		for _, c := range closers {
+			if err := c(); err != nil {
+				log.WithError(err).Error("unable to close recorder")
+			}
+		}
+	}
+
+	if cfg.AuditLog.Path != "" {
+		auditLog, err := audit.New(cfg.AuditLog, audit.Options{Logger: log})
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+
+		recorders = append(recorders, auditLog)
+		closers = append(closers, auditLog.Close)
+	}
+
+	if cfg.Journal.Path != "" {
+		j, err := journal.New(cfg.Journal, journal.Options{Logger: log})
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+
+		recorders = append(recorders, j)
+		closers = append(closers, j.Close)
+	}
+
+	return recorders, closeAll, nil
+}
+
+// startSinks subscribes every sink to the monitor, the returned function waits for them to
+// consume the last events once the monitor has stopped
+func startSinks(mon *monitor.Monitor, list []sinks.Sink) func() {
+	var wg sync.WaitGroup
+
+	for _, sink := range list {
+		events := mon.Subscribe(sink.Name(), sinkBuffer)
+
+		wg.Add(1)
+		go func(sink sinks.Sink) {
+			defer wg.Done()
+			sink.Run(events)
+		}(sink)
+	}
+
+	return wg.Wait
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/common"
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// statusMaxFiles is the number of files listed on the status page, every file is served by the
+// files endpoint of the api
+const statusMaxFiles = 500
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"time": func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+
+		return t.Format(time.RFC3339)
+	},
+	"hash": func(f monitor.FileStatus) string {
+		switch {
+		case f.Policy == "":
+			return "-"
+		case f.Digest == "":
+			return f.Policy
+		case f.Policy != hasher.PolicyFull:
+			return f.Algorithm + ":" + f.Digest + " (" + f.Policy + ")"
+		}
+
+		return f.Algorithm + ":" + f.Digest
+	},
+}).Parse(`<html>
+<head>
+<title>file_exporter</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+td.active { color: green; }
+td.pending { color: darkorange; }
+td.errored, td.permission_denied { color: red; }
+code { word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>file_exporter</h1>
+<p><a href="{{ .MetricsPath }}">Metrics</a></p>
+<h2>Paths</h2>
+<table>
+<tr><th>Path</th><th>Recursive</th><th>State</th><th>Files</th><th>Last Event</th><th>Error</th></tr>
+{{- range .Paths }}
+<tr><td>{{ .Path }}</td><td>{{ .Recursive }}</td><td class="{{ .State }}">{{ .State }}</td><td>{{ .Files }}</td><td>{{ time .LastEvent }} {{ .LastOp }}</td><td>{{ .Error }}</td></tr>
+{{- end }}
+</table>
+<h2>Files</h2>
+{{- if gt .TotalFiles (len .Files) }}
+<p>Showing the first {{ len .Files }} of {{ .TotalFiles }} files, see <a href="/api/v1/files">/api/v1/files</a> for every file.</p>
+{{- end }}
+<table>
+<tr><th>Path</th><th>Mode</th><th>Size</th><th>Last Event</th><th>Hash</th></tr>
+{{- range .Files }}
+<tr><td>{{ .Path }}</td><td>{{ .Mode }}</td><td>{{ .Size }}</td><td>{{ time .LastEvent }} {{ .LastOp }}</td><td><code>{{ hash . }}</code></td></tr>
+{{- end }}
+</table>
+<p><i>{{ .Version }}</i></p>
+</body>
+</html>
+`))
+
+// statusHandler renders the landing page from the state of the monitor
+type statusHandler struct {
+	log         *logrus.Logger
+	mon         *monitor.Monitor
+	metricsPath string
+}
+
+func (h *statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	files := h.mon.Files()
+	total := len(files)
+	if total > statusMaxFiles {
+		files = files[:statusMaxFiles]
+	}
+
+	err := statusTemplate.Execute(w, map[string]interface{}{
+		"MetricsPath": h.metricsPath,
+		"Paths":       h.mon.Paths(),
+		"Files":       files,
+		"TotalFiles":  total,
+		"Version":     common.AppVersion.Summary,
+	})
+	if err != nil {
+		h.log.WithError(err).Error("unable to render status page")
+	}
+}
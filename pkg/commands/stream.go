@@ -0,0 +1,202 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+	"github.com/sans-sroc/file_exporter/pkg/sinks"
+)
+
+const (
+	// streamHeartbeat is how often an idle stream sends a heartbeat so clients and proxies keep it open
+	streamHeartbeat = 15 * time.Second
+
+	// streamBuffer is the number of events queued for a client before they are dropped
+	streamBuffer = 256
+
+	// streamWriteTimeout bounds a single write to a websocket client
+	streamWriteTimeout = 10 * time.Second
+)
+
+// Stream transports
+const (
+	transportSSE       = "sse"
+	transportWebSocket = "websocket"
+)
+
+// streamMetrics describe the clients of the event stream, the events dropped for them are counted
+// by the monitor as for any subscriber
+type streamMetrics struct {
+	clients *prometheus.GaugeVec
+}
+
+func newStreamMetrics(reg prometheus.Registerer) (*streamMetrics, error) {
+	m := &streamMetrics{
+		clients: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_exporter_stream_clients",
+			Help: "Clients connected to the event stream",
+		}, []string{"transport"}),
+	}
+
+	if err := reg.Register(m.clients); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// streamMessage is sent to websocket clients, server-sent events carry the event alone and use the
+// type as the event name of anything else
+type streamMessage struct {
+	Type  string         `json:"type"`
+	Event *monitor.Event `json:"event,omitempty"`
+
+	// Time and Dropped are set on heartbeats, dropped is the number of events dropped for the
+	// client since it connected, whether they matched its filter or not
+	Time    *time.Time `json:"time,omitempty"`
+	Dropped *uint64    `json:"dropped,omitempty"`
+}
+
+// stream pushes events as they happen, over a websocket when the request asks for an upgrade and
+// as server-sent events otherwise. Events a client does not keep up with are dropped and counted.
+func (a *api) stream(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, err := sinks.NewFilter(query["path"], query["op"])
+	if err != nil {
+		a.error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		a.streamWebSocket(w, r, filter)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		a.error(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var id uint64
+
+	a.relay(r, transportSSE, filter, r.Context().Done(), func(msg streamMessage) error {
+		var err error
+
+		// events use the default message type so EventSource.onmessage receives them
+		if msg.Event != nil {
+			id++
+
+			var data []byte
+			if data, err = json.Marshal(msg.Event); err == nil {
+				_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, data)
+			}
+		} else {
+			var data []byte
+			if data, err = json.Marshal(msg); err == nil {
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		flusher.Flush()
+
+		return nil
+	})
+}
+
+func (a *api) streamWebSocket(w http.ResponseWriter, r *http.Request, filter *sinks.Filter) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		a.log.WithError(err).Debug("unable to upgrade event stream")
+		return
+	}
+	defer conn.Close()
+
+	// the client is not expected to send anything, reading handles pings and notices it leaving
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	a.relay(r, transportWebSocket, filter, closed, func(msg streamMessage) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+
+		return conn.WriteJSON(msg)
+	})
+
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
+
+// relay subscribes to the monitor and sends the events selected by the filter to a client until it
+// is gone, the monitor stops or the server shuts down. The subscription is the only queue of the
+// client, the monitor drops events rather than wait on it once it is full.
+func (a *api) relay(r *http.Request, transport string, filter *sinks.Filter, gone <-chan struct{}, send func(msg streamMessage) error) {
+	a.streamMetrics.clients.WithLabelValues(transport).Inc()
+	defer a.streamMetrics.clients.WithLabelValues(transport).Dec()
+
+	log := a.log.WithField("component", "stream").WithField("transport", transport).WithField("remote", r.RemoteAddr)
+	log.Debug("stream client connected")
+	defer log.Debug("stream client disconnected")
+
+	sub := a.mon.Subscribe("stream/"+transport, streamBuffer)
+	defer a.mon.Unsubscribe(sub)
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var msg streamMessage
+
+		select {
+		case event, ok := <-sub:
+			if !ok {
+				return
+			}
+
+			if !filter.Match(event) {
+				continue
+			}
+
+			msg = streamMessage{Type: "event", Event: &event}
+		case <-heartbeat.C:
+			now := time.Now()
+			dropped := a.mon.Dropped(sub)
+			msg = streamMessage{Type: "heartbeat", Time: &now, Dropped: &dropped}
+		case <-gone:
+			return
+		case <-a.ctx.Done():
+			return
+		}
+
+		if err := send(msg); err != nil {
+			log.WithError(err).Debug("unable to write to stream client")
+			return
+		}
+	}
+}
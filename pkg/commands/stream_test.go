@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		transport string
+
+		// connect opens the stream and returns a function reading the next event from it
+		connect func(t *testing.T, server string, query string) (func() monitor.Event, func())
+	}{
+		{
+			transport: transportSSE,
+			connect: func(t *testing.T, server string, query string) (func() monitor.Event, func()) {
+				resp, err := http.Get(server + "/api/v1/events/stream?" + query)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+					t.Fatalf("content type %q", got)
+				}
+
+				reader := bufio.NewReader(resp.Body)
+
+				next := func() monitor.Event {
+					for {
+						line, err := reader.ReadString('\n')
+						if err != nil {
+							t.Fatal(err)
+						}
+
+						data, ok := strings.CutPrefix(line, "data: ")
+						if !ok {
+							continue
+						}
+
+						var event monitor.Event
+						if err := json.Unmarshal([]byte(data), &event); err != nil {
+							t.Fatal(err)
+						}
+
+						return event
+					}
+				}
+
+				return next, func() { resp.Body.Close() }
+			},
+		},
+		{
+			transport: transportWebSocket,
+			connect: func(t *testing.T, server string, query string) (func() monitor.Event, func()) {
+				conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server, "http")+"/api/v1/events/stream?"+query, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				next := func() monitor.Event {
+					for {
+						var msg streamMessage
+						if err := conn.ReadJSON(&msg); err != nil {
+							t.Fatal(err)
+						}
+
+						if msg.Type == "event" {
+							return *msg.Event
+						}
+					}
+				}
+
+				return next, func() { conn.Close() }
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.transport, func(t *testing.T) {
+			dir := t.TempDir()
+
+			log := logrus.New()
+			log.SetOutput(io.Discard)
+
+			mon, err := monitor.New(monitor.Options{
+				Config: &config.Config{
+					Paths: []config.Path{{Path: dir, Interval: config.Duration{Duration: 10 * time.Millisecond}}},
+				},
+				Registerer: prometheus.NewRegistry(),
+				Logger:     log,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := mon.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer mon.Stop()
+
+			handler, err := newAPI(context.Background(), log, mon, nil, "", prometheus.NewRegistry())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			router := mux.NewRouter()
+			handler.register(router)
+
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			clients := handler.streamMetrics.clients.WithLabelValues(tt.transport)
+
+			waitClients := func(want float64) {
+				t.Helper()
+
+				for deadline := time.Now().Add(5 * time.Second); testutil.ToFloat64(clients) != want; {
+					if time.Now().After(deadline) {
+						t.Fatalf("%v clients connected, want %v", testutil.ToFloat64(clients), want)
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+
+			keep := filepath.ToSlash(filepath.Join(dir, "keep"))
+			query := url.Values{"path": {keep}, "op": {"create"}}.Encode()
+
+			next, disconnect := tt.connect(t, server.URL, query)
+			waitClients(1)
+
+			// only the events selected by the filter are sent
+			for _, name := range []string{"skip", "keep"} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if event := next(); event.Op != "CREATE" || event.Path != keep {
+				t.Fatalf("received %s %s, want CREATE %s", event.Op, event.Path, keep)
+			}
+
+			disconnect()
+			waitClients(0)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// apiToken returns the token given with --api.token or read from --api.token-file
+func apiToken(c *cli.Context) (string, error) {
+	if c.String("api.token-file") == "" {
+		return c.String("api.token"), nil
+	}
+
+	data, err := os.ReadFile(c.String("api.token-file"))
+	if err != nil {
+		return "", fmt.Errorf("unable to read api token: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// validToken reports whether the request carries token as `Authorization: Bearer <token>`
+func validToken(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
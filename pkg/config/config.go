@@ -0,0 +1,582 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+
+	"github.com/sans-sroc/file_exporter/pkg/atomicfile"
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+// DefaultInterval is the poll interval used when a path does not specify one
+const DefaultInterval = 100 * time.Millisecond
+
+// DefaultHash is the hash algorithm used when a path does not specify one
+const DefaultHash = hasher.CRC32
+
+// Backends used to detect changes to files
+const (
+	BackendPoll     = "poll"
+	BackendInotify  = "inotify"
+	BackendFanotify = "fanotify"
+	BackendAuto     = "auto"
+)
+
+// Optional stat metrics, each one adds a series per file
+const (
+	StatSize   = "size"
+	StatUID    = "uid"
+	StatGID    = "gid"
+	StatInode  = "inode"
+	StatLinks  = "links"
+	StatBlocks = "blocks"
+	StatType   = "type"
+)
+
+// Defaults for the large file hashing policies
+const (
+	DefaultLargeFileBytes  = 1024 * 1024
+	DefaultLargeFileBlocks = 16
+)
+
+// StatMetrics lists every optional stat metric
+var StatMetrics = []string{StatSize, StatUID, StatGID, StatInode, StatLinks, StatBlocks, StatType}
+
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Config is the top level structure of the configuration file
+type Config struct {
+	RootFS  string `yaml:"rootfs,omitempty" json:"rootfs,omitempty"`
+	Backend string `yaml:"backend,omitempty" json:"backend,omitempty"`
+	Paths   []Path `yaml:"paths,omitempty" json:"paths,omitempty"`
+
+	// HashWorkers is the number of files hashed concurrently
+	HashWorkers int `yaml:"hash_workers,omitempty" json:"hash_workers,omitempty"`
+
+	// HashBytesPerSecond limits the read throughput of all hash workers combined, 0 is unlimited
+	HashBytesPerSecond int64 `yaml:"hash_bytes_per_second,omitempty" json:"hash_bytes_per_second,omitempty"`
+
+	// StateFile keeps the last known state of every file across restarts so changes made while the
+	// exporter was not running are detected, it is only read at startup
+	StateFile string `yaml:"state_file,omitempty" json:"state_file,omitempty"`
+
+	// MaxTrackedFiles bounds the number of files whose state is kept in memory, the least recently
+	// updated are evicted first and only keep their digest, 0 is unlimited
+	MaxTrackedFiles int `yaml:"max_tracked_files,omitempty" json:"max_tracked_files,omitempty"`
+
+	// EventHistory is the number of recent events kept in memory, 0 keeps none
+	EventHistory int `yaml:"event_history,omitempty" json:"event_history,omitempty"`
+
+	// RehashInterval re-hashes files whose size, times and inode did not change once it has elapsed
+	RehashInterval Duration `yaml:"rehash_interval,omitempty" json:"rehash_interval,omitempty"`
+
+	// StatMetrics enables the optional stat metrics
+	StatMetrics []string `yaml:"stat_metrics,omitempty" json:"stat_metrics,omitempty"`
+
+	// LegacyModifiedTime reports the time a change was noticed as the modified time instead of the file's mtime
+	LegacyModifiedTime bool `yaml:"legacy_modified_time,omitempty" json:"legacy_modified_time,omitempty"`
+
+	// Webhooks receive every event as a CloudEvents document, they are only read at startup
+	Webhooks []Webhook `yaml:"webhooks,omitempty" json:"webhooks,omitempty"`
+
+	// Syslog sends an RFC 5424 message per event to each server, they are only read at startup
+	Syslog []Syslog `yaml:"syslog,omitempty" json:"syslog,omitempty"`
+
+	// AuditLog records every event to a local JSON Lines file, it is only read at startup
+	AuditLog AuditLog `yaml:"audit_log,omitempty" json:"audit_log,omitempty"`
+
+	// Journal records every event to a hash chained file signed with an ed25519 key, it is only
+	// read at startup
+	Journal Journal `yaml:"journal,omitempty" json:"journal,omitempty"`
+}
+
+// Path is a single monitoring rule, the path may be a file, a directory or a glob
+type Path struct {
+	Path          string            `yaml:"path,omitempty" json:"path,omitempty"`
+	Recursive     bool              `yaml:"recursive,omitempty" json:"recursive,omitempty"`
+	Regex         string            `yaml:"regex,omitempty" json:"regex,omitempty"`
+	RegexFullPath bool              `yaml:"regex_full_path,omitempty" json:"regex_full_path,omitempty"`
+	Hash          string            `yaml:"hash,omitempty" json:"hash,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Interval      Duration          `yaml:"interval,omitempty" json:"interval,omitempty"`
+
+	// Priority orders hashing, files of higher priority paths are hashed first
+	Priority int `yaml:"priority,omitempty" json:"priority,omitempty"`
+
+	// LargeFile hashes files above a size threshold with a cheaper policy
+	LargeFile LargeFile `yaml:"large_file,omitempty" json:"large_file,omitempty"`
+}
+
+// LargeFile is the hashing policy of files above a size threshold
+type LargeFile struct {
+	// Threshold is the size in bytes above which the policy applies, 0 hashes every file in full
+	Threshold int64 `yaml:"threshold,omitempty" json:"threshold,omitempty"`
+
+	// Policy is one of skip, head_tail or sample
+	Policy string `yaml:"policy,omitempty" json:"policy,omitempty"`
+
+	// Bytes is the number of bytes read from each end for head_tail, or the size of each block for sample
+	Bytes int64 `yaml:"bytes,omitempty" json:"bytes,omitempty"`
+
+	// Blocks is the number of evenly spaced blocks read for sample
+	Blocks int `yaml:"blocks,omitempty" json:"blocks,omitempty"`
+}
+
+// Webhook posts events to a URL as CloudEvents 1.0 JSON documents
+type Webhook struct {
+	// Name identifies the webhook in logs and metrics
+	Name string `yaml:"name" json:"name"`
+	URL  string `yaml:"url" json:"url"`
+
+	// Secret, or the content of SecretFile, signs every request with HMAC-SHA256
+	Secret     string `yaml:"secret,omitempty" json:"secret,omitempty"`
+	SecretFile string `yaml:"secret_file,omitempty" json:"secret_file,omitempty"`
+
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+
+	// Paths are globs matched against the path and old path of events, Ops the operations, both
+	// select every event when empty
+	Paths []string `yaml:"paths,omitempty" json:"paths,omitempty"`
+	Ops   []string `yaml:"ops,omitempty" json:"ops,omitempty"`
+
+	// Timeout bounds a single request
+	Timeout Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+
+	// MaxAttempts is the number of times an event is sent before it is dropped
+	MaxAttempts int `yaml:"max_attempts,omitempty" json:"max_attempts,omitempty"`
+
+	// QueueDir keeps undelivered events on disk so they survive a restart, they are only kept in
+	// memory without one. QueueSize bounds the events waiting, the oldest are dropped first.
+	QueueDir  string `yaml:"queue_dir,omitempty" json:"queue_dir,omitempty"`
+	QueueSize int    `yaml:"queue_size,omitempty" json:"queue_size,omitempty"`
+}
+
+// Syslog networks
+const (
+	SyslogUDP  = "udp"
+	SyslogTCP  = "tcp"
+	SyslogTLS  = "tls"
+	SyslogUnix = "unix"
+)
+
+// DefaultSyslogSocket is the local syslog socket used when no address is given
+const DefaultSyslogSocket = "/dev/log"
+
+// Syslog sends events to a syslog server as RFC 5424 messages with structured data
+type Syslog struct {
+	// Name identifies the server in logs and metrics
+	Name string `yaml:"name" json:"name"`
+
+	// Network is one of udp, tcp, tls or unix, Address is a host:port or the path of the socket
+	Network string `yaml:"network,omitempty" json:"network,omitempty"`
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+
+	// Facility is the name of the facility, local0 by default
+	Facility string `yaml:"facility,omitempty" json:"facility,omitempty"`
+
+	// AppName and Hostname override the fields of the header
+	AppName  string `yaml:"app_name,omitempty" json:"app_name,omitempty"`
+	Hostname string `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+
+	// SDID is the id of the structured data element, it must be name@<private enterprise number>
+	SDID string `yaml:"sd_id,omitempty" json:"sd_id,omitempty"`
+
+	Paths []string `yaml:"paths,omitempty" json:"paths,omitempty"`
+	Ops   []string `yaml:"ops,omitempty" json:"ops,omitempty"`
+
+	// TLS is used with the tls network
+	TLS TLS `yaml:"tls,omitempty" json:"tls,omitempty"`
+}
+
+// TLS configures the client side of a TLS connection
+type TLS struct {
+	CAFile             string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty" json:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty" json:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
+}
+
+// AuditLog is an append-only JSON Lines file with one event per line
+type AuditLog struct {
+	// Path of the file, the audit log is disabled when empty
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+
+	// MaxSize and MaxAge rotate the file once it is larger or older, MaxAge 0 never rotates by age
+	MaxSize int64    `yaml:"max_size,omitempty" json:"max_size,omitempty"`
+	MaxAge  Duration `yaml:"max_age,omitempty" json:"max_age,omitempty"`
+
+	// MaxSegments is the number of rotated files kept, the oldest are removed first, 0 keeps them all
+	MaxSegments int `yaml:"max_segments,omitempty" json:"max_segments,omitempty"`
+
+	// Compress gzips rotated files
+	Compress bool `yaml:"compress,omitempty" json:"compress,omitempty"`
+
+	// SyncInterval is how often written events are flushed to disk with fsync, defaults to 1s
+	SyncInterval Duration `yaml:"sync_interval,omitempty" json:"sync_interval,omitempty"`
+
+	// SyncEveryEvent flushes every event to disk before it is acknowledged instead, at the cost of
+	// an fsync per event
+	SyncEveryEvent bool `yaml:"sync_every_event,omitempty" json:"sync_every_event,omitempty"`
+}
+
+// Journal is a tamper evident record of events, each record holds the hash of the previous one and
+// the head of the chain is signed periodically
+type Journal struct {
+	// Path of the file, the journal is disabled when empty
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+
+	// KeyFile is the ed25519 private key the chain is signed with, as a PKCS #8 PEM file
+	KeyFile string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+
+	// SignInterval is how often the head of the chain is signed when events were recorded
+	SignInterval Duration `yaml:"sign_interval,omitempty" json:"sign_interval,omitempty"`
+}
+
+// Duration wraps time.Duration so it can be expressed as "30s" in both YAML and JSON
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	return d.parse(s)
+}
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	return d.parse(s)
+}
+
+// MarshalYAML renders the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// MarshalJSON renders the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) parse(s string) error {
+	if s == "" {
+		d.Duration = 0
+		return nil
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = v
+
+	return nil
+}
+
+// Load reads a configuration file, files ending in .json are parsed as JSON, everything else as YAML
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, cfg)
+	} else {
+		err = yaml.UnmarshalStrict(data, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Save writes a configuration file atomically, files ending in .json are written as JSON, everything
+// else as YAML. Comments and formatting of the previous file are not preserved.
+func Save(path string, cfg *Config) error {
+	var data []byte
+	var err error
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err = json.MarshalIndent(cfg, "", "  ")
+	} else {
+		data, err = yaml.Marshal(cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	return atomicfile.WriteFile(path, data, mode)
+}
+
+// ApplyDefaults fills in any per path settings that were left empty with the given defaults
+func (c *Config) ApplyDefaults(defaults Path) {
+	for i := range c.Paths {
+		c.Paths[i].ApplyDefaults(defaults)
+	}
+}
+
+// ApplyDefaults fills in any settings that were left empty with the given defaults, then with the built in ones
+func (p *Path) ApplyDefaults(defaults Path) {
+	if p.Regex == "" && defaults.Regex != "" {
+		p.Regex = defaults.Regex
+		p.RegexFullPath = defaults.RegexFullPath
+	}
+	if p.Hash == "" {
+		p.Hash = defaults.Hash
+	}
+	if p.Hash == "" {
+		p.Hash = DefaultHash
+	}
+	if p.Interval.Duration == 0 {
+		p.Interval = defaults.Interval
+	}
+	if p.Interval.Duration == 0 {
+		p.Interval.Duration = DefaultInterval
+	}
+	if p.LargeFile.Bytes == 0 {
+		p.LargeFile.Bytes = DefaultLargeFileBytes
+	}
+	if p.LargeFile.Blocks == 0 {
+		p.LargeFile.Blocks = DefaultLargeFileBlocks
+	}
+}
+
+// Validate checks that every path can be used by the monitor
+func (c *Config) Validate() error {
+	if len(c.Paths) == 0 {
+		return errors.New("at least one path must be configured for monitoring")
+	}
+
+	switch c.Backend {
+	case "", BackendPoll, BackendInotify, BackendFanotify, BackendAuto:
+	default:
+		return fmt.Errorf("unsupported backend %q", c.Backend)
+	}
+
+	if c.HashWorkers < 0 {
+		return errors.New("hash workers must not be negative")
+	}
+
+	if c.HashBytesPerSecond < 0 {
+		return errors.New("hash bytes per second must not be negative")
+	}
+
+	if c.MaxTrackedFiles < 0 {
+		return errors.New("max tracked files must not be negative")
+	}
+
+	if c.EventHistory < 0 {
+		return errors.New("event history must not be negative")
+	}
+
+	if c.RehashInterval.Duration < 0 {
+		return errors.New("rehash interval must not be negative")
+	}
+
+	for _, name := range c.StatMetrics {
+		if !slices.Contains(StatMetrics, name) {
+			return fmt.Errorf("unsupported stat metric %q, must be one of %s", name, strings.Join(StatMetrics, ", "))
+		}
+	}
+
+	for _, p := range c.Paths {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+
+	names := map[string]bool{}
+	for _, w := range c.Webhooks {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+
+		if names[w.Name] {
+			return fmt.Errorf("webhook %s: name must be unique", w.Name)
+		}
+		names[w.Name] = true
+	}
+
+	names = map[string]bool{}
+	for _, l := range c.Syslog {
+		if err := l.Validate(); err != nil {
+			return err
+		}
+
+		if names[l.Name] {
+			return fmt.Errorf("syslog %s: name must be unique", l.Name)
+		}
+		names[l.Name] = true
+	}
+
+	if err := c.AuditLog.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Journal.Validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Validate checks that the path can be used by the monitor
+func (p Path) Validate() error {
+	if p.Path == "" {
+		return errors.New("path must not be empty")
+	}
+
+	if p.Regex != "" {
+		if _, err := regexp.Compile(p.Regex); err != nil {
+			return fmt.Errorf("path %s: invalid regex: %w", p.Path, err)
+		}
+	}
+
+	if p.Hash != "" && !hasher.IsSupported(p.Hash) {
+		return fmt.Errorf("path %s: unsupported hash algorithm %q, must be one of %s", p.Path, p.Hash, strings.Join(hasher.Supported(), ", "))
+	}
+
+	if p.Interval.Duration < 0 {
+		return fmt.Errorf("path %s: interval must not be negative", p.Path)
+	}
+
+	if err := p.LargeFile.validate(); err != nil {
+		return fmt.Errorf("path %s: large file: %w", p.Path, err)
+	}
+
+	for k := range p.Labels {
+		// names starting with __ are reserved for internal use by Prometheus
+		if k == "path" || strings.HasPrefix(k, "__") || !labelNameRegex.MatchString(k) {
+			return fmt.Errorf("path %s: invalid label name %q", p.Path, k)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that the webhook can be used
+func (w Webhook) Validate() error {
+	if w.Name == "" {
+		return errors.New("webhook name must not be empty")
+	}
+
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook %s: url must be an http or https url", w.Name)
+	}
+
+	if w.Secret != "" && w.SecretFile != "" {
+		return fmt.Errorf("webhook %s: only one of secret and secret_file may be set", w.Name)
+	}
+
+	if w.Timeout.Duration < 0 || w.MaxAttempts < 0 || w.QueueSize < 0 {
+		return fmt.Errorf("webhook %s: timeout, max_attempts and queue_size must not be negative", w.Name)
+	}
+
+	return nil
+}
+
+// Validate checks that the syslog server can be used
+func (l Syslog) Validate() error {
+	if l.Name == "" {
+		return errors.New("syslog name must not be empty")
+	}
+
+	switch l.Network {
+	case "", SyslogUnix:
+	case SyslogUDP, SyslogTCP, SyslogTLS:
+		if l.Address == "" {
+			return fmt.Errorf("syslog %s: address must be set for %s", l.Name, l.Network)
+		}
+	default:
+		return fmt.Errorf("syslog %s: unsupported network %q, must be one of %s, %s, %s or %s", l.Name, l.Network, SyslogUDP, SyslogTCP, SyslogTLS, SyslogUnix)
+	}
+
+	if (l.TLS.CertFile == "") != (l.TLS.KeyFile == "") {
+		return fmt.Errorf("syslog %s: tls cert_file and key_file must be set together", l.Name)
+	}
+
+	return nil
+}
+
+// Validate checks the rotation settings of the audit log
+func (a AuditLog) Validate() error {
+	if a.MaxSize < 0 || a.MaxAge.Duration < 0 || a.MaxSegments < 0 || a.SyncInterval.Duration < 0 {
+		return errors.New("audit_log: max_size, max_age, max_segments and sync_interval must not be negative")
+	}
+
+	if a.SyncEveryEvent && a.SyncInterval.Duration != 0 {
+		return errors.New("audit_log: only one of sync_interval and sync_every_event can be set")
+	}
+
+	return nil
+}
+
+// Validate checks that a journal can be signed
+func (j Journal) Validate() error {
+	if j.Path != "" && j.KeyFile == "" {
+		return errors.New("journal: key_file must be set")
+	}
+
+	if j.SignInterval.Duration < 0 {
+		return errors.New("journal: sign_interval must not be negative")
+	}
+
+	return nil
+}
+
+func (l LargeFile) validate() error {
+	if l.Threshold < 0 {
+		return errors.New("threshold must not be negative")
+	}
+
+	if l.Threshold == 0 {
+		return nil
+	}
+
+	switch l.Policy {
+	case hasher.PolicySkip, hasher.PolicyHeadTail, hasher.PolicySample:
+	default:
+		return fmt.Errorf("unsupported policy %q, must be one of %s, %s or %s", l.Policy, hasher.PolicySkip, hasher.PolicyHeadTail, hasher.PolicySample)
+	}
+
+	if l.Bytes < 0 {
+		return errors.New("bytes must not be negative")
+	}
+
+	if l.Policy == hasher.PolicySample && l.Blocks < 2 {
+		return errors.New("sample needs at least 2 blocks")
+	}
+
+	return nil
+}
@@ -0,0 +1,321 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{Paths: []Path{{Path: "/etc/passwd"}}}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		err    string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name:   "no paths",
+			modify: func(c *Config) { c.Paths = nil },
+			err:    "at least one path",
+		},
+		{
+			name:   "empty path",
+			modify: func(c *Config) { c.Paths[0].Path = "" },
+			err:    "path must not be empty",
+		},
+		{
+			name:   "unsupported backend",
+			modify: func(c *Config) { c.Backend = "kqueue" },
+			err:    "unsupported backend",
+		},
+		{
+			name:   "every backend",
+			modify: func(c *Config) { c.Backend = BackendFanotify },
+		},
+		{
+			name:   "negative hash workers",
+			modify: func(c *Config) { c.HashWorkers = -1 },
+			err:    "hash workers",
+		},
+		{
+			name:   "negative max tracked files",
+			modify: func(c *Config) { c.MaxTrackedFiles = -1 },
+			err:    "max tracked files",
+		},
+		{
+			name:   "negative event history",
+			modify: func(c *Config) { c.EventHistory = -1 },
+			err:    "event history",
+		},
+		{
+			name:   "negative rehash interval",
+			modify: func(c *Config) { c.RehashInterval.Duration = -time.Second },
+			err:    "rehash interval",
+		},
+		{
+			name:   "unsupported stat metric",
+			modify: func(c *Config) { c.StatMetrics = []string{StatSize, "color"} },
+			err:    `unsupported stat metric "color"`,
+		},
+		{
+			name:   "invalid regex",
+			modify: func(c *Config) { c.Paths[0].Regex = "(" },
+			err:    "invalid regex",
+		},
+		{
+			name:   "unsupported hash",
+			modify: func(c *Config) { c.Paths[0].Hash = "md4" },
+			err:    "unsupported hash algorithm",
+		},
+		{
+			name:   "negative interval",
+			modify: func(c *Config) { c.Paths[0].Interval.Duration = -time.Second },
+			err:    "interval must not be negative",
+		},
+		{
+			name:   "label",
+			modify: func(c *Config) { c.Paths[0].Labels = map[string]string{"team": "platform"} },
+		},
+		{
+			name:   "large file without policy",
+			modify: func(c *Config) { c.Paths[0].LargeFile = LargeFile{Threshold: 1024} },
+			err:    "unsupported policy",
+		},
+		{
+			name:   "sample with one block",
+			modify: func(c *Config) { c.Paths[0].LargeFile = LargeFile{Threshold: 1024, Policy: "sample", Blocks: 1} },
+			err:    "at least 2 blocks",
+		},
+		{
+			name:   "head tail",
+			modify: func(c *Config) { c.Paths[0].LargeFile = LargeFile{Threshold: 1024, Policy: "head_tail"} },
+		},
+		{
+			name:   "webhook",
+			modify: func(c *Config) { c.Webhooks = []Webhook{{Name: "siem", URL: "https://siem.example.com/events"}} },
+		},
+		{
+			name:   "webhook without scheme",
+			modify: func(c *Config) { c.Webhooks = []Webhook{{Name: "siem", URL: "siem.example.com"}} },
+			err:    "url must be an http or https url",
+		},
+		{
+			name: "webhook with two secrets",
+			modify: func(c *Config) {
+				c.Webhooks = []Webhook{{Name: "siem", URL: "https://siem.example.com", Secret: "s", SecretFile: "/s"}}
+			},
+			err: "only one of secret and secret_file",
+		},
+		{
+			name: "duplicate webhook",
+			modify: func(c *Config) {
+				c.Webhooks = []Webhook{{Name: "siem", URL: "https://a.example.com"}, {Name: "siem", URL: "https://b.example.com"}}
+			},
+			err: "name must be unique",
+		},
+		{
+			name:   "syslog over the local socket",
+			modify: func(c *Config) { c.Syslog = []Syslog{{Name: "local"}} },
+		},
+		{
+			name:   "syslog without address",
+			modify: func(c *Config) { c.Syslog = []Syslog{{Name: "remote", Network: SyslogTCP}} },
+			err:    "address must be set",
+		},
+		{
+			name:   "syslog network",
+			modify: func(c *Config) { c.Syslog = []Syslog{{Name: "remote", Network: "sctp"}} },
+			err:    "unsupported network",
+		},
+		{
+			name: "syslog cert without key",
+			modify: func(c *Config) {
+				c.Syslog = []Syslog{{Name: "remote", Network: SyslogTLS, Address: "siem:6514", TLS: TLS{CertFile: "/c"}}}
+			},
+			err: "cert_file and key_file",
+		},
+		{
+			name:   "negative audit log size",
+			modify: func(c *Config) { c.AuditLog = AuditLog{Path: "/var/log/audit.jsonl", MaxSize: -1} },
+			err:    "audit_log",
+		},
+		{
+			name: "audit log synced both ways",
+			modify: func(c *Config) {
+				c.AuditLog = AuditLog{Path: "/var/log/audit.jsonl", SyncInterval: Duration{Duration: time.Second}, SyncEveryEvent: true}
+			},
+			err: "only one of sync_interval and sync_every_event",
+		},
+		{
+			name:   "journal without key",
+			modify: func(c *Config) { c.Journal = Journal{Path: "/var/lib/journal.jsonl"} },
+			err:    "key_file must be set",
+		},
+		{
+			name: "journal",
+			modify: func(c *Config) {
+				c.Journal = Journal{Path: "/var/lib/journal.jsonl", KeyFile: "/etc/journal.key"}
+			},
+		},
+		{
+			name:   "path label",
+			modify: func(c *Config) { c.Paths[0].Labels = map[string]string{"path": "x"} },
+			err:    "invalid label name",
+		},
+		{
+			name:   "reserved label",
+			modify: func(c *Config) { c.Paths[0].Labels = map[string]string{"__name__": "x"} },
+			err:    "invalid label name",
+		},
+		{
+			name:   "invalid label",
+			modify: func(c *Config) { c.Paths[0].Labels = map[string]string{"1team": "x"} },
+			err:    "invalid label name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(c)
+
+			err := c.Validate()
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && err == nil:
+				t.Fatalf("expected an error containing %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		want Path
+		err  string
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			data: "paths:\n  - path: /etc\n    recursive: true\n    regex: \\.conf$\n    interval: 5s\n    labels:\n      team: platform\n",
+			want: Path{
+				Path:      "/etc",
+				Recursive: true,
+				Regex:     `\.conf$`,
+				Interval:  Duration{Duration: 5 * time.Second},
+				Labels:    map[string]string{"team": "platform"},
+			},
+		},
+		{
+			name: "json",
+			file: "config.json",
+			data: `{"paths": [{"path": "/etc/passwd", "hash": "crc32", "interval": "1m"}]}`,
+			want: Path{Path: "/etc/passwd", Hash: "crc32", Interval: Duration{Duration: time.Minute}},
+		},
+		{
+			name: "unknown field",
+			file: "config.yaml",
+			data: "paths:\n  - path: /etc\n    recursve: true\n",
+			err:  "unable to parse config file",
+		},
+		{
+			name: "invalid duration",
+			file: "config.yaml",
+			data: "paths:\n  - path: /etc\n    interval: soon\n",
+			err:  "unable to parse config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(file, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(file)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(cfg.Paths) != 1 || !reflect.DeepEqual(cfg.Paths[0], tt.want) {
+				t.Fatalf("loaded %+v, want %+v", cfg.Paths, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	defaults := Path{Regex: "^a", Hash: "crc32", Interval: Duration{Duration: time.Second}}
+	largeFile := LargeFile{Bytes: DefaultLargeFileBytes, Blocks: DefaultLargeFileBlocks}
+
+	tests := []struct {
+		name string
+		path Path
+		want Path
+	}{
+		{
+			name: "empty",
+			path: Path{Path: "/etc"},
+			want: Path{Path: "/etc", Regex: "^a", Hash: "crc32", Interval: Duration{Duration: time.Second}, LargeFile: largeFile},
+		},
+		{
+			name: "set on the path",
+			path: Path{Path: "/etc", Regex: "^b", RegexFullPath: true, Interval: Duration{Duration: time.Minute}},
+			want: Path{Path: "/etc", Regex: "^b", RegexFullPath: true, Hash: "crc32", Interval: Duration{Duration: time.Minute}, LargeFile: largeFile},
+		},
+		{
+			name: "large file policy",
+			path: Path{Path: "/etc", LargeFile: LargeFile{Threshold: 1024, Policy: "sample", Blocks: 4}},
+			want: Path{
+				Path:      "/etc",
+				Regex:     "^a",
+				Hash:      "crc32",
+				Interval:  Duration{Duration: time.Second},
+				LargeFile: LargeFile{Threshold: 1024, Policy: "sample", Bytes: DefaultLargeFileBytes, Blocks: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Paths: []Path{tt.path}}
+			cfg.ApplyDefaults(defaults)
+
+			if !reflect.DeepEqual(cfg.Paths[0], tt.want) {
+				t.Fatalf("got %+v, want %+v", cfg.Paths[0], tt.want)
+			}
+		})
+	}
+
+	cfg := &Config{Paths: []Path{{Path: "/etc"}}}
+	cfg.ApplyDefaults(Path{})
+
+	if cfg.Paths[0].Hash != DefaultHash || cfg.Paths[0].Interval.Duration != DefaultInterval {
+		t.Fatalf("got %+v, want the package defaults", cfg.Paths[0])
+	}
+}
@@ -0,0 +1,127 @@
+package hasher
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Supported hash algorithms
+const (
+	CRC32    = "crc32"
+	MD5      = "md5"
+	SHA256   = "sha256"
+	SHA512   = "sha512"
+	BLAKE2b  = "blake2b"
+	XXHash64 = "xxhash64"
+)
+
+var providers = map[string]func() hash.Hash{
+	CRC32:  func() hash.Hash { return crc32.NewIEEE() },
+	MD5:    md5.New,
+	SHA256: sha256.New,
+	SHA512: sha512.New,
+	BLAKE2b: func() hash.Hash {
+		h, _ := blake2b.New512(nil)
+		return h
+	},
+	XXHash64: func() hash.Hash { return xxhash.New() },
+}
+
+// Result holds the digests of a file's content
+type Result struct {
+	// CRC32 is always computed, it is exported as a number for backwards compatibility
+	CRC32 uint32 `json:"crc32"`
+
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest,omitempty"`
+
+	// Size is the number of bytes hashed
+	Size int64 `json:"size"`
+
+	// Policy is the policy that selected the bytes hashed with its parameters, as returned by
+	// Policy.String
+	Policy string `json:"policy"`
+}
+
+// New returns a hash for the algorithm
+func New(algorithm string) (hash.Hash, error) {
+	provider, ok := providers[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm %q", algorithm)
+	}
+
+	return provider(), nil
+}
+
+// Supported returns the names of every supported algorithm
+func Supported() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// IsSupported reports whether the algorithm can be used
+func IsSupported(algorithm string) bool {
+	_, ok := providers[algorithm]
+	return ok
+}
+
+// File hashes the content of a file with CRC32 and the given algorithm in a single read
+func File(path string, algorithm string) (*Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Reader(file, algorithm)
+}
+
+// Reader hashes everything read from r with CRC32 and the given algorithm
+func Reader(r io.Reader, algorithm string) (*Result, error) {
+	crc := crc32.NewIEEE()
+
+	var h hash.Hash = crc
+	var w io.Writer = crc
+
+	if algorithm != CRC32 {
+		var err error
+		h, err = New(algorithm)
+		if err != nil {
+			return nil, err
+		}
+
+		w = io.MultiWriter(crc, h)
+	}
+
+	// read chunks of 32k
+	buf := make([]byte, 32*1024)
+
+	n, err := io.CopyBuffer(w, r, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		CRC32:     crc.Sum32(),
+		Algorithm: algorithm,
+		Digest:    hex.EncodeToString(h.Sum(nil)),
+		Size:      n,
+		Policy:    PolicyFull,
+	}, nil
+}
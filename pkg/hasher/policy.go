@@ -0,0 +1,86 @@
+package hasher
+
+import (
+	"fmt"
+	"io"
+)
+
+// Policies for hashing large files
+const (
+	// PolicyFull hashes the whole file
+	PolicyFull = "full"
+
+	// PolicySkip does not hash the file at all
+	PolicySkip = "skip"
+
+	// PolicyHeadTail hashes the first and last Bytes of the file
+	PolicyHeadTail = "head_tail"
+
+	// PolicySample hashes Blocks evenly spaced blocks of Bytes each, including the first and last
+	PolicySample = "sample"
+)
+
+// Policies lists every supported policy
+var Policies = []string{PolicyFull, PolicySkip, PolicyHeadTail, PolicySample}
+
+// Policy selects which parts of a file are hashed
+type Policy struct {
+	Name   string
+	Bytes  int64
+	Blocks int
+}
+
+// String describes the policy and its parameters
+func (p Policy) String() string {
+	switch p.Name {
+	case PolicyHeadTail:
+		return fmt.Sprintf("%s:%d", p.Name, p.Bytes)
+	case PolicySample:
+		return fmt.Sprintf("%s:%dx%d", p.Name, p.Blocks, p.Bytes)
+	}
+
+	return p.Name
+}
+
+// Reader returns the parts of r covered by the policy for a file of the given size
+func (p Policy) Reader(r io.ReaderAt, size int64) io.Reader {
+	var readers []io.Reader
+
+	for _, s := range p.sections(size) {
+		readers = append(readers, io.NewSectionReader(r, s[0], s[1]))
+	}
+
+	return io.MultiReader(readers...)
+}
+
+// sections returns the offset and length of every part to read, in order and without overlap
+func (p Policy) sections(size int64) [][2]int64 {
+	switch p.Name {
+	case PolicyHeadTail:
+		if p.Bytes <= 0 || 2*p.Bytes >= size {
+			break
+		}
+
+		return [][2]int64{{0, p.Bytes}, {size - p.Bytes, p.Bytes}}
+	case PolicySample:
+		if p.Bytes <= 0 || p.Blocks < 2 || int64(p.Blocks)*p.Bytes >= size {
+			break
+		}
+
+		stride := (size - p.Bytes) / int64(p.Blocks-1)
+
+		sections := make([][2]int64, 0, p.Blocks)
+		for i := 0; i < p.Blocks; i++ {
+			offset := int64(i) * stride
+			if i == p.Blocks-1 {
+				offset = size - p.Bytes
+			}
+
+			sections = append(sections, [2]int64{offset, p.Bytes})
+		}
+
+		return sections
+	}
+
+	return [][2]int64{{0, size}}
+}
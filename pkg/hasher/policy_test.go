@@ -0,0 +1,102 @@
+package hasher
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestPolicySections(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		size   int64
+		want   [][2]int64
+	}{
+		{
+			name:   "full",
+			policy: Policy{Name: PolicyFull},
+			size:   100,
+			want:   [][2]int64{{0, 100}},
+		},
+		{
+			name:   "empty file",
+			policy: Policy{Name: PolicyFull},
+			size:   0,
+			want:   [][2]int64{{0, 0}},
+		},
+		{
+			name:   "head tail",
+			policy: Policy{Name: PolicyHeadTail, Bytes: 10},
+			size:   100,
+			want:   [][2]int64{{0, 10}, {90, 10}},
+		},
+		{
+			name:   "head tail overlapping",
+			policy: Policy{Name: PolicyHeadTail, Bytes: 50},
+			size:   100,
+			want:   [][2]int64{{0, 100}},
+		},
+		{
+			name:   "head tail without bytes",
+			policy: Policy{Name: PolicyHeadTail},
+			size:   100,
+			want:   [][2]int64{{0, 100}},
+		},
+		{
+			name:   "sample",
+			policy: Policy{Name: PolicySample, Bytes: 10, Blocks: 4},
+			size:   100,
+			want:   [][2]int64{{0, 10}, {30, 10}, {60, 10}, {90, 10}},
+		},
+		{
+			name:   "sample uneven stride ends on the last block",
+			policy: Policy{Name: PolicySample, Bytes: 10, Blocks: 3},
+			size:   101,
+			want:   [][2]int64{{0, 10}, {45, 10}, {91, 10}},
+		},
+		{
+			name:   "sample covering the file",
+			policy: Policy{Name: PolicySample, Bytes: 25, Blocks: 4},
+			size:   100,
+			want:   [][2]int64{{0, 100}},
+		},
+		{
+			name:   "sample with one block",
+			policy: Policy{Name: PolicySample, Bytes: 10, Blocks: 1},
+			size:   100,
+			want:   [][2]int64{{0, 100}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.sections(tt.size)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("sections(%d) = %v, want %v", tt.size, got, tt.want)
+			}
+
+			for i := 1; i < len(got); i++ {
+				if got[i][0] < got[i-1][0]+got[i-1][1] {
+					t.Fatalf("section %v overlaps %v", got[i], got[i-1])
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyReader(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+
+	r := Policy{Name: PolicyHeadTail, Bytes: 3}.Reader(bytes.NewReader(data), int64(len(data)))
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "012hij" {
+		t.Fatalf("read %q, want %q", got, "012hij")
+	}
+}
@@ -0,0 +1,404 @@
+// Package journal keeps a tamper evident record of the events of a monitor. Every record holds the
+// hash of the record before it and the head of the chain is signed periodically with an ed25519
+// key, so a record that is changed, removed or inserted breaks the chain or a signature.
+package journal
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+	"github.com/sans-sroc/file_exporter/pkg/signing"
+)
+
+// DefaultSignInterval is how often the head of the chain is signed when no sign_interval is given
+const DefaultSignInterval = time.Minute
+
+// genesis is the previous hash of the first record
+var genesis = hex.EncodeToString(make([]byte, sha256.Size))
+
+// Record is a line of the journal, it holds either an event or a signature of the records before it
+type Record struct {
+	// Seq numbers the records from 1 without gaps
+	Seq uint64 `json:"seq"`
+
+	// Prev is the hex encoded SHA-256 of the previous line, without its newline
+	Prev string `json:"prev"`
+
+	Event     *monitor.Event `json:"event,omitempty"`
+	Signature *Signature     `json:"signature,omitempty"`
+}
+
+// Signature signs the head of the chain, which covers every record before it
+type Signature struct {
+	// KeyID identifies the public key, it is the start of the hex encoded SHA-256 of the key
+	KeyID string    `json:"key_id"`
+	Time  time.Time `json:"time"`
+
+	// Value is the base64 encoded ed25519 signature of the seq, prev and time of the record
+	Value string `json:"value"`
+}
+
+// signedMessage is what the signature of a record signs
+func signedMessage(seq uint64, prev string, t time.Time) []byte {
+	return []byte("file_exporter journal " + strconv.FormatUint(seq, 10) + " " + prev + " " + t.UTC().Format(time.RFC3339Nano))
+}
+
+// hash returns the hex encoded SHA-256 of a line
+func hash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// Options configures a Journal
+type Options struct {
+	// Registerer is where the metrics of the journal are registered, defaults to prometheus.DefaultRegisterer
+	Registerer prometheus.Registerer
+
+	// Logger defaults to the standard logrus logger
+	Logger *logrus.Logger
+}
+
+type metrics struct {
+	records    prometheus.Counter
+	errors     prometheus.Counter
+	signatures prometheus.Counter
+}
+
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		records: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_exporter_journal_records_total",
+			Help: "Events recorded in the journal",
+		}),
+
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_exporter_journal_errors_total",
+			Help: "Events or signatures that could not be written to the journal",
+		}),
+
+		signatures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_exporter_journal_signatures_total",
+			Help: "Signatures of the head of the chain written to the journal",
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{m.records, m.errors, m.signatures} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Journal appends events to a hash chained file and signs the head of the chain once events were
+// recorded, every sign interval and when it is closed
+type Journal struct {
+	cfg      config.Journal
+	key      ed25519.PrivateKey
+	keyID    string
+	metrics  *metrics
+	logEntry *logrus.Entry
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	seq      uint64
+	head     string
+	unsigned int
+	closed   bool
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// New opens the journal and continues the chain of the file when it exists, a record left
+// incomplete by a crash is removed
+func New(cfg config.Journal, opts Options) (*Journal, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Path == "" {
+		return nil, errors.New("journal: path must be set")
+	}
+
+	if cfg.SignInterval.Duration == 0 {
+		cfg.SignInterval.Duration = DefaultSignInterval
+	}
+
+	key, err := signing.LoadPrivateKey(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("journal: %w", err)
+	}
+
+	reg := opts.Registerer
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	log := opts.Logger
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+
+	metrics, err := newMetrics(reg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to register journal metrics: %w", err)
+	}
+
+	j := &Journal{
+		cfg:      cfg,
+		key:      key,
+		keyID:    signing.KeyID(key.Public().(ed25519.PublicKey)),
+		metrics:  metrics,
+		logEntry: log.WithField("component", "journal"),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o750); err != nil {
+		return nil, err
+	}
+
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+
+	go j.run()
+
+	return j, nil
+}
+
+// Record appends an event to the chain
+func (j *Journal) Record(event monitor.Event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.append(Record{Event: &event}); err != nil {
+		j.metrics.errors.Inc()
+		return fmt.Errorf("unable to write journal: %w", err)
+	}
+
+	j.unsigned++
+	j.metrics.records.Inc()
+
+	return nil
+}
+
+// Close signs the records that are not signed yet and closes the file
+func (j *Journal) Close() error {
+	j.stopOnce.Do(func() { close(j.stop) })
+	<-j.done
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return nil
+	}
+
+	err := j.sign()
+	j.closed = true
+
+	if serr := j.file.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := j.file.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func (j *Journal) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.cfg.SignInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-j.stop:
+			return
+		}
+
+		j.mu.Lock()
+		if err := j.sign(); err != nil {
+			j.logEntry.WithError(err).Error("unable to sign journal")
+		}
+		j.mu.Unlock()
+	}
+}
+
+// sign appends a signature of the head of the chain when records were appended since the last
+// one and flushes the file to disk, j.mu must be held
+func (j *Journal) sign() error {
+	if j.unsigned == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	record := Record{
+		Signature: &Signature{
+			KeyID: j.keyID,
+			Time:  now,
+			Value: base64.StdEncoding.EncodeToString(ed25519.Sign(j.key, signedMessage(j.seq+1, j.head, now))),
+		},
+	}
+
+	if err := j.append(record); err != nil {
+		j.metrics.errors.Inc()
+		return err
+	}
+
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+
+	j.unsigned = 0
+	j.metrics.signatures.Inc()
+	j.logEntry.WithField("seq", j.seq).WithField("head", j.head).Debug("signed journal")
+
+	return nil
+}
+
+// append numbers a record, links it to the head of the chain and writes it, a failed write is
+// removed so the chain stays intact. j.mu must be held.
+func (j *Journal) append(record Record) error {
+	if j.closed {
+		return os.ErrClosed
+	}
+
+	record.Seq = j.seq + 1
+	record.Prev = j.head
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := j.file.WriteAt(append(line, '\n'), j.size); err != nil {
+		if terr := j.file.Truncate(j.size); terr != nil {
+			j.logEntry.WithError(terr).Error("unable to remove incomplete journal record")
+		}
+		return err
+	}
+
+	j.size += int64(len(line)) + 1
+	j.seq = record.Seq
+	j.head = hash(line)
+
+	return nil
+}
+
+// open opens the file and reads the last record to continue the chain
+func (j *Journal) open() error {
+	file, err := os.OpenFile(j.cfg.Path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	size := info.Size()
+
+	end, err := lineStart(file, size)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if end < size {
+		j.logEntry.WithField("bytes", size-end).Warn("removing incomplete journal record")
+
+		if err := file.Truncate(end); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	j.file = file
+	j.size = end
+	j.head = genesis
+
+	if end == 0 {
+		return nil
+	}
+
+	start, err := lineStart(file, end-1)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	line := make([]byte, end-1-start)
+	if _, err := file.ReadAt(line, start); err != nil {
+		file.Close()
+		return err
+	}
+
+	var last Record
+	if err := json.Unmarshal(line, &last); err != nil || last.Seq == 0 {
+		file.Close()
+		return fmt.Errorf("journal: the last record of %s is invalid, verify the journal", j.cfg.Path)
+	}
+
+	j.seq = last.Seq
+	j.head = hash(line)
+
+	// events recorded before a crash are signed with the next signature
+	if last.Signature == nil {
+		j.unsigned = 1
+	}
+
+	return nil
+}
+
+// lineStart returns the offset following the last newline before end, or 0 when there is none
+func lineStart(file *os.File, end int64) (int64, error) {
+	buf := make([]byte, 4096)
+
+	for end > 0 {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+
+		if _, err := file.ReadAt(buf[:n], end-n); err != nil {
+			return 0, err
+		}
+
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] == '\n' {
+				return end - n + i + 1, nil
+			}
+		}
+
+		end -= n
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,187 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sans-sroc/file_exporter/pkg/signing"
+)
+
+// Report is the result of the verification of a journal
+type Report struct {
+	// Records is the number of valid records, Events and Signatures split them by kind
+	Records    int
+	Events     int
+	Signatures int
+
+	// Signed is the seq of the last record covered by a valid signature, records after it are
+	// Unsigned. Signatures are not checked without a public key.
+	Signed   uint64
+	Unsigned int
+
+	// UnsignedSince is the time of the first unsigned event, zero when every event is signed
+	UnsignedSince time.Time
+
+	// Head is the hash of the last valid record
+	Head string
+
+	// Broken is the first broken link, nil when the whole chain is intact
+	Broken *Link
+}
+
+// Link locates a record that does not follow from the ones before it
+type Link struct {
+	// Line is the line of the file, counted from 1
+	Line   int
+	Seq    uint64
+	Reason string
+}
+
+func (l *Link) String() string {
+	if l.Seq == 0 {
+		return fmt.Sprintf("line %d: %s", l.Line, l.Reason)
+	}
+
+	return fmt.Sprintf("line %d (seq %d): %s", l.Line, l.Seq, l.Reason)
+}
+
+// Anchor is a point of the chain kept outside of the journal, such as the seq and head printed by a
+// previous verification. The chain only covers the records before the end of the file, so records
+// removed from the end, back to an earlier signature, are only detected against an anchor.
+type Anchor struct {
+	// Seq is the seq of a record the journal must hold, 0 to skip the check
+	Seq uint64
+
+	// Head is the hash of that record, or of any record when Seq is 0, empty to skip the check
+	Head string
+}
+
+// Verify walks the chain of a journal and stops at the first broken link, the signatures are
+// checked against the public key when one is given and the journal must reach the anchor when one
+// is given
+func Verify(r io.Reader, key ed25519.PublicKey, anchor *Anchor) (*Report, error) {
+	report := &Report{Head: genesis}
+
+	// the anchor is reached once a record matches it
+	anchored := anchor == nil || (anchor.Seq == 0 && anchor.Head == "")
+
+	var keyID string
+	if key != nil {
+		keyID = signing.KeyID(key)
+	}
+
+	reader := bufio.NewReader(r)
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		expected := uint64(report.Records) + 1
+
+		broken := func(reason string, args ...interface{}) (*Report, error) {
+			report.Broken = &Link{Line: lineNumber, Seq: expected, Reason: fmt.Sprintf(reason, args...)}
+			return report, nil
+		}
+
+		if err == io.EOF {
+			return broken("the record is incomplete")
+		}
+
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+
+		var record Record
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&record); err != nil {
+			return broken("not a journal record: %v", err)
+		}
+
+		if record.Seq != expected {
+			return broken("found seq %d, records were removed or inserted", record.Seq)
+		}
+
+		if record.Prev != report.Head {
+			return broken("the previous record was changed, its hash does not match")
+		}
+
+		switch {
+		case record.Event != nil && record.Signature == nil:
+			if report.Unsigned == 0 {
+				report.UnsignedSince = record.Event.Time
+			}
+
+			report.Events++
+			report.Unsigned++
+		case record.Signature != nil && record.Event == nil:
+			if key != nil {
+				sig := record.Signature
+
+				if sig.KeyID != keyID {
+					return broken("signed with key %s instead of %s", sig.KeyID, keyID)
+				}
+
+				value, err := base64.StdEncoding.DecodeString(sig.Value)
+				if err != nil || !ed25519.Verify(key, signedMessage(record.Seq, record.Prev, sig.Time), value) {
+					return broken("the signature is invalid")
+				}
+
+				report.Signed = record.Seq - 1
+				report.Unsigned = 0
+				report.UnsignedSince = time.Time{}
+			}
+
+			report.Signatures++
+		default:
+			return broken("a record holds either an event or a signature")
+		}
+
+		head := hash(line)
+
+		if anchor != nil && anchor.Seq == record.Seq && anchor.Head != "" && anchor.Head != head {
+			return broken("the hash of the record is not the expected head %s", anchor.Head)
+		}
+
+		if !anchored && anchor.matches(record.Seq, head) {
+			anchored = true
+		}
+
+		report.Records++
+		report.Head = head
+	}
+
+	if !anchored {
+		report.Broken = &Link{
+			Line:   report.Records + 1,
+			Seq:    uint64(report.Records) + 1,
+			Reason: fmt.Sprintf("the journal ends before %s, records were removed from its end", anchor),
+		}
+	}
+
+	return report, nil
+}
+
+func (a *Anchor) matches(seq uint64, head string) bool {
+	return (a.Seq == 0 || a.Seq == seq) && (a.Head == "" || a.Head == head)
+}
+
+func (a *Anchor) String() string {
+	switch {
+	case a.Seq == 0:
+		return "head " + a.Head
+	case a.Head == "":
+		return fmt.Sprintf("seq %d", a.Seq)
+	default:
+		return fmt.Sprintf("seq %d with head %s", a.Seq, a.Head)
+	}
+}
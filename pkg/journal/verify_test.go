@@ -0,0 +1,305 @@
+package journal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// writeJournal records two events per run of the journal, each run is signed when it is closed,
+// and returns the lines of the file and the public key
+func writeJournal(t *testing.T, runs int) ([][]byte, ed25519.PublicKey) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(dir, "journal.key")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Journal{
+		Path:         filepath.Join(dir, "journal.jsonl"),
+		KeyFile:      keyFile,
+		SignInterval: config.Duration{Duration: time.Hour},
+	}
+
+	for run := 0; run < runs; run++ {
+		j, err := New(cfg, Options{Registerer: prometheus.NewRegistry()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, op := range []string{"CREATE", "WRITE"} {
+			if err := j.Record(monitor.Event{Time: time.Now(), Op: op, Path: "/etc/passwd"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := j.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.SplitAfter(data, []byte{'\n'})[:3*runs], public
+}
+
+// rechain links every record from index i to the one before it again, as an attacker without the
+// key would after changing a record
+func rechain(t *testing.T, lines [][]byte, i int) [][]byte {
+	t.Helper()
+
+	head := genesis
+	if i > 0 {
+		head = hash(bytes.TrimSuffix(lines[i-1], []byte{'\n'}))
+	}
+
+	for ; i < len(lines); i++ {
+		var record Record
+		if err := json.Unmarshal(lines[i], &record); err != nil {
+			t.Fatal(err)
+		}
+
+		record.Prev = head
+
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines[i] = append(line, '\n')
+		head = hash(line)
+	}
+
+	return lines
+}
+
+func TestVerify(t *testing.T) {
+	// two runs: event, event, signature, event, event, signature
+	lines, key := writeJournal(t, 2)
+
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headOf := func(i int) string {
+		return hash(bytes.TrimSuffix(lines[i], []byte{'\n'}))
+	}
+
+	tests := []struct {
+		name   string
+		modify func(lines [][]byte) [][]byte
+		key    ed25519.PublicKey
+		anchor *Anchor
+
+		// broken is part of the reason of the first broken link, at line, empty when the chain is intact
+		broken   string
+		line     int
+		records  int
+		signed   uint64
+		unsigned int
+	}{
+		{
+			name:    "intact",
+			key:     key,
+			records: 6,
+			signed:  5,
+		},
+		{
+			name:     "intact without key",
+			records:  6,
+			unsigned: 4,
+		},
+		{
+			name:   "wrong key",
+			key:    other,
+			broken: "signed with key",
+			line:   3,
+		},
+		{
+			name: "changed event",
+			modify: func(lines [][]byte) [][]byte {
+				lines[0] = bytes.Replace(lines[0], []byte("/etc/passwd"), []byte("/etc/shadow"), 1)
+				return lines
+			},
+			broken: "the previous record was changed",
+			line:   2,
+		},
+		{
+			name: "changed and rechained event",
+			modify: func(lines [][]byte) [][]byte {
+				lines[3] = bytes.Replace(lines[3], []byte("/etc/passwd"), []byte("/etc/shadow"), 1)
+				return rechain(t, lines, 3)
+			},
+			key:    key,
+			broken: "the signature is invalid",
+			line:   6,
+		},
+		{
+			name: "inserted record",
+			modify: func(lines [][]byte) [][]byte {
+				return append(lines[:2], append([][]byte{lines[1]}, lines[2:]...)...)
+			},
+			broken: "found seq 2",
+			line:   3,
+		},
+		{
+			name: "deleted record",
+			modify: func(lines [][]byte) [][]byte {
+				return append(lines[:1], lines[2:]...)
+			},
+			broken: "found seq 3",
+			line:   2,
+		},
+		{
+			name: "deleted and renumbered record",
+			modify: func(lines [][]byte) [][]byte {
+				lines = append(lines[:1], lines[2:]...)
+				for i := 1; i < len(lines); i++ {
+					lines[i] = bytes.Replace(lines[i], []byte(`"seq":`+strconv.Itoa(i+2)), []byte(`"seq":`+strconv.Itoa(i+1)), 1)
+				}
+				return rechain(t, lines, 1)
+			},
+			key:    key,
+			broken: "the signature is invalid",
+			line:   2,
+		},
+		{
+			name: "incomplete record",
+			modify: func(lines [][]byte) [][]byte {
+				lines[5] = lines[5][:10]
+				return lines
+			},
+			broken: "the record is incomplete",
+			line:   6,
+		},
+		{
+			name: "unsigned tail",
+			modify: func(lines [][]byte) [][]byte {
+				return lines[:4]
+			},
+			key:      key,
+			records:  4,
+			signed:   2,
+			unsigned: 1,
+		},
+		{
+			name: "truncated to a signature",
+			modify: func(lines [][]byte) [][]byte {
+				return lines[:3]
+			},
+			key:     key,
+			records: 3,
+			signed:  2,
+		},
+		{
+			name: "truncated before the anchored seq",
+			modify: func(lines [][]byte) [][]byte {
+				return lines[:3]
+			},
+			key:    key,
+			anchor: &Anchor{Seq: 6},
+			broken: "the journal ends before seq 6",
+			line:   4,
+		},
+		{
+			name: "truncated before the anchored head",
+			modify: func(lines [][]byte) [][]byte {
+				return lines[:3]
+			},
+			anchor: &Anchor{Head: headOf(5)},
+			broken: "the journal ends before head",
+			line:   4,
+		},
+		{
+			name:    "anchored",
+			key:     key,
+			anchor:  &Anchor{Seq: 3, Head: headOf(2)},
+			records: 6,
+			signed:  5,
+		},
+		{
+			name:   "anchored head does not match",
+			anchor: &Anchor{Seq: 3, Head: headOf(1)},
+			broken: "is not the expected head",
+			line:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := make([][]byte, len(lines))
+			for i, line := range lines {
+				modified[i] = bytes.Clone(line)
+			}
+
+			if tt.modify != nil {
+				modified = tt.modify(modified)
+			}
+
+			report, err := Verify(bytes.NewReader(bytes.Join(modified, nil)), tt.key, tt.anchor)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.broken != "" {
+				if report.Broken == nil {
+					t.Fatalf("the chain is intact, want broken at line %d: %s", tt.line, tt.broken)
+				}
+
+				if report.Broken.Line != tt.line || !strings.Contains(report.Broken.Reason, tt.broken) {
+					t.Fatalf("broken at %s, want line %d: %s", report.Broken, tt.line, tt.broken)
+				}
+
+				return
+			}
+
+			if report.Broken != nil {
+				t.Fatalf("broken at %s", report.Broken)
+			}
+
+			if report.Records != tt.records || report.Signed != tt.signed || report.Unsigned != tt.unsigned {
+				t.Fatalf("%d records, signed up to %d, %d unsigned, want %d, %d, %d",
+					report.Records, report.Signed, report.Unsigned, tt.records, tt.signed, tt.unsigned)
+			}
+
+			if tt.unsigned > 0 && report.UnsignedSince.IsZero() {
+				t.Fatal("the time of the first unsigned event is not set")
+			}
+
+			if report.Head != headOf(tt.records-1) && tt.modify == nil {
+				t.Fatalf("head %s, want %s", report.Head, headOf(tt.records-1))
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package monitor
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+// backend produces file events for the paths added to it, the method set mirrors watcher.Watcher
+type backend interface {
+	Add(path string) error
+	AddRecursive(path string) error
+	WatchedFiles() map[string]os.FileInfo
+
+	// Start blocks delivering events every interval until Close is called
+	Start(interval time.Duration) error
+	Close()
+
+	Events() <-chan watcher.Event
+	Errors() <-chan error
+	Done() <-chan struct{}
+}
+
+// newBackend creates the requested backend, polling when none is set. Kernel backends share the
+// sources of hubs and fall back to polling when they cannot be created.
+func newBackend(hubs *notifyHubs, name string, filters ...watcher.FilterFileHookFunc) backend {
+	switch name {
+	case "":
+		name = config.BackendPoll
+	case config.BackendAuto:
+		name = defaultKernelBackend
+	}
+
+	if name != config.BackendPoll {
+		b, err := newNotifyBackend(hubs, name, filters...)
+		if err == nil {
+			return b
+		}
+
+		logrus.WithError(err).WithField("backend", name).Warn("unable to create backend, falling back to polling")
+	}
+
+	return newPollBackend(filters...)
+}
+
+// pollBackend is the original polling watcher, it stats every file on every interval
+type pollBackend struct {
+	*watcher.Watcher
+
+	// watcher.Watcher ignores a Close that comes before Start has marked it running, started and
+	// closed make sure such a Close still stops it
+	mu      sync.Mutex
+	started bool
+	closed  bool
+}
+
+func newPollBackend(filters ...watcher.FilterFileHookFunc) *pollBackend {
+	w := watcher.New()
+	for _, f := range filters {
+		w.AddFilterHook(f)
+	}
+
+	return &pollBackend{Watcher: w}
+}
+
+func (b *pollBackend) Start(interval time.Duration) error {
+	if interval < time.Nanosecond {
+		return watcher.ErrDurationTooShort
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.started = true
+	b.mu.Unlock()
+
+	return b.Watcher.Start(interval)
+}
+
+func (b *pollBackend) Close() {
+	b.mu.Lock()
+	started := b.started
+	b.closed = true
+	b.mu.Unlock()
+
+	if !started {
+		return
+	}
+
+	// Wait returns once Start has marked the watcher running
+	b.Watcher.Wait()
+	b.Watcher.Close()
+}
+
+func (b *pollBackend) Events() <-chan watcher.Event {
+	return b.Event
+}
+
+func (b *pollBackend) Errors() <-chan error {
+	return b.Error
+}
+
+func (b *pollBackend) Done() <-chan struct{} {
+	return b.Closed
+}
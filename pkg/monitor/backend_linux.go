@@ -0,0 +1,982 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+const defaultKernelBackend = config.BackendInotify
+
+// rawOp is the kind of change reported by a kernel notification source
+type rawOp uint8
+
+const (
+	rawCreate rawOp = iota
+	rawWrite
+	rawChmod
+	rawRemove
+	rawMovedFrom
+	rawMovedTo
+	rawOverflow
+)
+
+type rawEvent struct {
+	op     rawOp
+	path   string
+	cookie uint32
+}
+
+// notifySource is a kernel notification API reporting changes to the entries of watched directories
+type notifySource interface {
+	watch(dir string) error
+	unwatch(dir string)
+	read() ([]rawEvent, error)
+	close() error
+}
+
+// watchError is returned when the kernel refuses a watch, the path is then polled instead
+type watchError struct {
+	path string
+	err  error
+}
+
+func (e *watchError) Error() string {
+	return fmt.Sprintf("unable to watch %s: %v", e.path, e.err)
+}
+
+func (e *watchError) Unwrap() error {
+	return e.err
+}
+
+// notifyHubs holds the kernel notification sources of a monitor, one per backend, so paths on the
+// same filesystem do not each need their own inotify instance or fanotify mark
+type notifyHubs struct {
+	mu   sync.Mutex
+	hubs map[string]*notifyHub
+}
+
+func newNotifyHubs() *notifyHubs {
+	return &notifyHubs{hubs: map[string]*notifyHub{}}
+}
+
+// get returns the hub of a backend and creates its source the first time, fanotify falls back to
+// the inotify hub when it cannot be used
+func (h *notifyHubs) get(name string) (*notifyHub, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.getLocked(name)
+}
+
+func (h *notifyHubs) getLocked(name string) (*notifyHub, error) {
+	if hub, ok := h.hubs[name]; ok {
+		return hub, nil
+	}
+
+	var source notifySource
+	var err error
+
+	switch name {
+	case config.BackendFanotify:
+		source, err = newFanotifySource()
+		if err != nil {
+			logrus.WithError(err).Warn("unable to use fanotify (requires CAP_SYS_ADMIN), falling back to inotify")
+
+			hub, err := h.getLocked(config.BackendInotify)
+			if err != nil {
+				return nil, err
+			}
+
+			h.hubs[name] = hub
+
+			return hub, nil
+		}
+	case config.BackendInotify:
+		source, err = newInotifySource()
+	default:
+		err = fmt.Errorf("unknown backend %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hub := newNotifyHub(source)
+	h.hubs[name] = hub
+
+	return hub, nil
+}
+
+// close closes every source once the backends using them are closed
+func (h *notifyHubs) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	closed := map[*notifyHub]bool{}
+	for name, hub := range h.hubs {
+		if !closed[hub] {
+			_ = hub.source.close()
+			closed[hub] = true
+		}
+
+		delete(h.hubs, name)
+	}
+}
+
+// notifyHub shares a kernel notification source between backends. Each directory is watched once
+// however many backends watch it, and events are dispatched to the backends watching the directory
+// they happened in.
+type notifyHub struct {
+	source notifySource
+
+	mu       sync.Mutex
+	dirs     map[string]map[*notifyBackend]bool
+	backends map[*notifyBackend]bool
+}
+
+func newNotifyHub(source notifySource) *notifyHub {
+	h := &notifyHub{
+		source:   source,
+		dirs:     map[string]map[*notifyBackend]bool{},
+		backends: map[*notifyBackend]bool{},
+	}
+
+	go h.readLoop()
+
+	return h
+}
+
+func (h *notifyHub) attach(b *notifyBackend) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.backends[b] = true
+}
+
+// detach stops dispatching events to a backend and releases the directories it watched
+func (h *notifyHub) detach(b *notifyBackend) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.backends, b)
+
+	for dir := range h.dirs {
+		h.unwatchLocked(b, dir)
+	}
+}
+
+// watch watches a directory on behalf of a backend. The kernel is asked again even when another
+// backend watches it already since the watch is dropped when the directory is removed.
+func (h *notifyHub) watch(b *notifyBackend, dir string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.source.watch(dir); err != nil {
+		return err
+	}
+
+	if h.dirs[dir] == nil {
+		h.dirs[dir] = map[*notifyBackend]bool{}
+	}
+
+	h.dirs[dir][b] = true
+
+	return nil
+}
+
+// unwatch stops watching a directory on behalf of a backend, the kernel watch is removed once no
+// backend watches it
+func (h *notifyHub) unwatch(b *notifyBackend, dir string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.unwatchLocked(b, dir)
+}
+
+func (h *notifyHub) unwatchLocked(b *notifyBackend, dir string) {
+	watchers, ok := h.dirs[dir]
+	if !ok || !watchers[b] {
+		return
+	}
+
+	delete(watchers, b)
+
+	if len(watchers) == 0 {
+		delete(h.dirs, dir)
+		h.source.unwatch(dir)
+	}
+}
+
+func (h *notifyHub) readLoop() {
+	for {
+		events, err := h.source.read()
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return
+			}
+
+			h.mu.Lock()
+			for b := range h.backends {
+				b.fail(err)
+			}
+			h.mu.Unlock()
+
+			return
+		}
+
+		h.dispatch(events)
+	}
+}
+
+// dispatch hands every backend the events of the directories it watches, in order, along with
+// the removal of a watched directory itself. An overflow goes to every backend.
+func (h *notifyHub) dispatch(events []rawEvent) {
+	batches := map[*notifyBackend][]rawEvent{}
+
+	h.mu.Lock()
+	for _, e := range events {
+		if e.op == rawOverflow {
+			for b := range h.backends {
+				batches[b] = append(batches[b], e)
+			}
+			continue
+		}
+
+		for b := range h.dirs[filepath.Dir(e.path)] {
+			batches[b] = append(batches[b], e)
+		}
+
+		for b := range h.dirs[e.path] {
+			if !h.dirs[filepath.Dir(e.path)][b] {
+				batches[b] = append(batches[b], e)
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	for b, events := range batches {
+		b.process(events)
+	}
+}
+
+type notifyRoot struct {
+	recursive bool
+
+	// parent is the directory watched on behalf of a single file
+	parent string
+}
+
+// notifyBackend turns kernel notifications into the same events the poller produces.
+// Events are coalesced per path and delivered once per interval.
+type notifyBackend struct {
+	hub     *notifyHub
+	filters []watcher.FilterFileHookFunc
+
+	events chan watcher.Event
+	errors chan error
+	closed chan struct{}
+	close  chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex
+	running  bool
+	interval time.Duration
+	fallback *pollBackend
+	roots    map[string]*notifyRoot
+	dirs     map[string]bool
+	files    map[string]os.FileInfo
+	pending  map[string]watcher.Event
+	order    []string
+	deleted  int
+}
+
+func newNotifyBackend(hubs *notifyHubs, name string, filters ...watcher.FilterFileHookFunc) (backend, error) {
+	hub, err := hubs.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &notifyBackend{
+		hub:     hub,
+		filters: filters,
+		events:  make(chan watcher.Event),
+		errors:  make(chan error),
+		closed:  make(chan struct{}),
+		close:   make(chan struct{}),
+		roots:   map[string]*notifyRoot{},
+		dirs:    map[string]bool{},
+		files:   map[string]os.FileInfo{},
+		pending: map[string]watcher.Event{},
+	}
+
+	hub.attach(b)
+
+	return b, nil
+}
+
+func (b *notifyBackend) Events() <-chan watcher.Event {
+	return b.events
+}
+
+func (b *notifyBackend) Errors() <-chan error {
+	return b.errors
+}
+
+func (b *notifyBackend) Done() <-chan struct{} {
+	return b.closed
+}
+
+func (b *notifyBackend) Add(path string) error {
+	return b.add(path, false)
+}
+
+func (b *notifyBackend) AddRecursive(path string) error {
+	return b.add(path, true)
+}
+
+func (b *notifyBackend) add(path string, recursive bool) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if fs := unsupportedFilesystem(path); fs != "" {
+		logrus.WithField("path", path).WithField("filesystem", fs).Info("filesystem does not support notifications, polling path")
+		return b.addFallback(path, recursive)
+	}
+
+	files, watched, err := b.list(path, info, recursive)
+	if err != nil {
+		for _, dir := range watched {
+			b.release(dir)
+		}
+
+		var werr *watchError
+		if errors.As(err, &werr) {
+			logrus.WithError(err).WithField("path", path).Warn("unable to add kernel watch, polling path")
+			return b.addFallback(path, recursive)
+		}
+
+		return err
+	}
+
+	for k, v := range files {
+		b.files[k] = v
+	}
+
+	root := &notifyRoot{recursive: recursive}
+	if !info.IsDir() {
+		root.parent = filepath.Dir(path)
+	}
+	b.roots[path] = root
+
+	return nil
+}
+
+// addFallback hands the path to a poller, b.mu must be held
+func (b *notifyBackend) addFallback(path string, recursive bool) error {
+	if b.fallback == nil {
+		b.fallback = newPollBackend(b.filters...)
+		if b.running {
+			go b.runFallback(b.fallback, b.interval)
+		}
+	}
+
+	if recursive {
+		return b.fallback.AddRecursive(path)
+	}
+
+	return b.fallback.Add(path)
+}
+
+func (b *notifyBackend) runFallback(fb *pollBackend, interval time.Duration) {
+	go func() {
+		for {
+			select {
+			case e := <-fb.Event:
+				select {
+				case b.events <- e:
+				case <-b.close:
+					return
+				}
+			case err := <-fb.Error:
+				select {
+				case b.errors <- err:
+				case <-b.close:
+					return
+				}
+			case <-fb.Closed:
+				return
+			case <-b.close:
+				return
+			}
+		}
+	}()
+
+	if err := fb.Start(interval); err != nil {
+		logrus.WithError(err).Error("unable to start fallback poller")
+	}
+}
+
+// list watches the directories needed for path and returns the files it covers,
+// directories are watched before they are read so no change in between is missed
+func (b *notifyBackend) list(path string, info os.FileInfo, recursive bool) (map[string]os.FileInfo, []string, error) {
+	files := map[string]os.FileInfo{path: info}
+	var watched []string
+
+	if !info.IsDir() {
+		dir := filepath.Dir(path)
+		if err := b.watchDir(dir); err != nil {
+			return nil, watched, err
+		}
+
+		return files, append(watched, dir), nil
+	}
+
+	if !recursive {
+		if err := b.watchDir(path); err != nil {
+			return nil, watched, err
+		}
+		watched = append(watched, path)
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, watched, err
+		}
+
+		for _, entry := range entries {
+			p := filepath.Join(path, entry.Name())
+
+			fi, err := entry.Info()
+			if err != nil || b.filtered(fi, p) {
+				continue
+			}
+
+			files[p] = fi
+		}
+
+		return files, watched, nil
+	}
+
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			if err := b.watchDir(p); err != nil {
+				return err
+			}
+			watched = append(watched, p)
+		}
+
+		if p != path && b.filtered(fi, p) {
+			return nil
+		}
+
+		files[p] = fi
+
+		return nil
+	})
+
+	return files, watched, err
+}
+
+func (b *notifyBackend) filtered(info os.FileInfo, path string) bool {
+	for _, f := range b.filters {
+		if err := f(info, path); err != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *notifyBackend) watchDir(dir string) error {
+	if b.dirs[dir] {
+		return nil
+	}
+
+	if err := b.hub.watch(b, dir); err != nil {
+		return &watchError{path: dir, err: err}
+	}
+
+	b.dirs[dir] = true
+
+	return nil
+}
+
+// release stops watching a directory unless a root still depends on it
+func (b *notifyBackend) release(dir string) {
+	if !b.dirs[dir] {
+		return
+	}
+
+	for root, r := range b.roots {
+		if r.parent == dir || root == dir || (r.recursive && isUnder(dir, root)) {
+			return
+		}
+	}
+
+	b.hub.unwatch(b, dir)
+	delete(b.dirs, dir)
+}
+
+// covered returns the root a path belongs to
+func (b *notifyBackend) covered(path string) (*notifyRoot, bool) {
+	for root, r := range b.roots {
+		switch {
+		case path == root:
+			return r, true
+		case r.parent != "":
+			continue
+		case r.recursive && isUnder(path, root):
+			return r, true
+		case !r.recursive && filepath.Dir(path) == root:
+			return r, true
+		}
+	}
+
+	return nil, false
+}
+
+// fail reports that the source stopped reading events, without holding up the hub
+func (b *notifyBackend) fail(err error) {
+	go func() {
+		select {
+		case b.errors <- err:
+		case <-b.close:
+		}
+	}()
+}
+
+func (b *notifyBackend) process(events []rawEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	moves := map[uint32]string{}
+
+	for _, e := range events {
+		switch e.op {
+		case rawOverflow:
+			b.rescan()
+		case rawCreate:
+			b.created(e.path)
+		case rawWrite:
+			b.changed(e.path, watcher.Write)
+		case rawChmod:
+			b.changed(e.path, watcher.Chmod)
+		case rawRemove:
+			b.removed(e.path)
+		case rawMovedFrom:
+			if e.cookie == 0 {
+				b.removed(e.path)
+				continue
+			}
+			moves[e.cookie] = e.path
+		case rawMovedTo:
+			old, ok := moves[e.cookie]
+			if e.cookie == 0 || !ok {
+				b.created(e.path)
+				continue
+			}
+			delete(moves, e.cookie)
+			b.renamed(old, e.path)
+		}
+	}
+
+	// moved out of any watched directory
+	for _, old := range moves {
+		b.removed(old)
+	}
+}
+
+func (b *notifyBackend) created(path string) {
+	if _, ok := b.files[path]; ok {
+		b.changed(path, watcher.Write)
+		return
+	}
+
+	root, ok := b.covered(path)
+	if !ok {
+		return
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return
+	}
+
+	if info.IsDir() && root.recursive {
+		files, _, err := b.list(path, info, true)
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Error("unable to watch new directory")
+		}
+
+		for p, fi := range files {
+			if _, ok := b.files[p]; ok {
+				continue
+			}
+
+			b.files[p] = fi
+			b.queue(watcher.Event{Op: watcher.Create, Path: p, FileInfo: fi})
+		}
+
+		return
+	}
+
+	if b.filtered(info, path) {
+		return
+	}
+
+	b.files[path] = info
+	b.queue(watcher.Event{Op: watcher.Create, Path: path, FileInfo: info})
+}
+
+func (b *notifyBackend) changed(path string, op watcher.Op) {
+	if _, ok := b.files[path]; !ok {
+		return
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return
+	}
+
+	b.files[path] = info
+
+	if info.IsDir() {
+		return
+	}
+
+	b.queue(watcher.Event{Op: op, Path: path, FileInfo: info})
+}
+
+func (b *notifyBackend) removed(path string) {
+	// anything tracked below path lives in a watched directory, so only those need a full scan
+	if info, ok := b.files[path]; !b.dirs[path] && (!ok || !info.IsDir()) {
+		if ok {
+			b.removeFile(path, info)
+		}
+		return
+	}
+
+	for p, info := range b.files {
+		if p == path || isUnder(p, path) {
+			b.removeFile(p, info)
+		}
+	}
+
+	for dir := range b.dirs {
+		if dir == path || isUnder(dir, path) {
+			b.hub.unwatch(b, dir)
+			delete(b.dirs, dir)
+		}
+	}
+
+	for root := range b.roots {
+		if root == path || isUnder(root, path) {
+			b.removeRoot(root)
+		}
+	}
+}
+
+func (b *notifyBackend) removeFile(path string, info os.FileInfo) {
+	delete(b.files, path)
+
+	r, isRoot := b.roots[path]
+
+	// like the poller, the removal of a non-recursive root is only reported as an error
+	if !isRoot || r.recursive {
+		b.queue(watcher.Event{Op: watcher.Remove, Path: path, FileInfo: info})
+	}
+
+	if isRoot {
+		b.removeRoot(path)
+	}
+}
+
+func (b *notifyBackend) removeRoot(root string) {
+	r, ok := b.roots[root]
+	if !ok {
+		return
+	}
+
+	delete(b.roots, root)
+	b.deleted++
+
+	if r.parent != "" {
+		b.release(r.parent)
+	}
+}
+
+func (b *notifyBackend) renamed(old, path string) {
+	_, known := b.files[old]
+	_, isRoot := b.roots[old]
+	_, covered := b.covered(path)
+
+	info, err := os.Lstat(path)
+	if !known || isRoot || !covered || err != nil || info.IsDir() || b.filtered(info, path) {
+		b.removed(old)
+		b.created(path)
+		return
+	}
+
+	delete(b.files, old)
+	b.files[path] = info
+
+	if prev, ok := b.pending[old]; ok && prev.Op == watcher.Create {
+		delete(b.pending, old)
+		b.queue(watcher.Event{Op: watcher.Create, Path: path, FileInfo: info})
+		return
+	}
+
+	b.queue(watcher.Event{Op: watcher.Rename, Path: path, OldPath: old, FileInfo: info})
+}
+
+// rescan re-lists every root after the kernel queue overflowed and events were lost
+func (b *notifyBackend) rescan() {
+	logrus.Warn("kernel event queue overflowed, rescanning watched paths")
+
+	current := map[string]os.FileInfo{}
+
+	roots := make(map[string]*notifyRoot, len(b.roots))
+	for root, r := range b.roots {
+		roots[root] = r
+	}
+
+	for root, r := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			b.removed(root)
+			continue
+		}
+
+		files, _, err := b.list(root, info, r.recursive)
+		if err != nil {
+			logrus.WithError(err).WithField("path", root).Error("unable to rescan path")
+		}
+
+		for k, v := range files {
+			current[k] = v
+		}
+	}
+
+	for p := range b.files {
+		if _, ok := current[p]; !ok {
+			b.removed(p)
+		}
+	}
+
+	for p, info := range current {
+		old, ok := b.files[p]
+		b.files[p] = info
+
+		switch {
+		case !ok:
+			b.queue(watcher.Event{Op: watcher.Create, Path: p, FileInfo: info})
+		case info.IsDir():
+		case !old.ModTime().Equal(info.ModTime()) || old.Size() != info.Size():
+			b.queue(watcher.Event{Op: watcher.Write, Path: p, FileInfo: info})
+		case old.Mode() != info.Mode():
+			b.queue(watcher.Event{Op: watcher.Chmod, Path: p, FileInfo: info})
+		}
+	}
+}
+
+// queue coalesces events for the same path until the next flush
+func (b *notifyBackend) queue(e watcher.Event) {
+	prev, ok := b.pending[e.Path]
+	if !ok {
+		b.pending[e.Path] = e
+		b.order = append(b.order, e.Path)
+		return
+	}
+
+	switch {
+	case e.Op == watcher.Remove && prev.Op == watcher.Create:
+		delete(b.pending, e.Path)
+	case e.Op == watcher.Remove:
+		b.pending[e.Path] = e
+	case prev.Op == watcher.Remove:
+		// replaced within the same interval
+		e.Op = watcher.Write
+		b.pending[e.Path] = e
+	case prev.Op == watcher.Create || prev.Op == watcher.Rename || (prev.Op == watcher.Write && e.Op == watcher.Chmod):
+		prev.FileInfo = e.FileInfo
+		b.pending[e.Path] = prev
+	default:
+		b.pending[e.Path] = e
+	}
+}
+
+func (b *notifyBackend) flush() {
+	b.mu.Lock()
+
+	events := make([]watcher.Event, 0, len(b.pending))
+	for _, p := range b.order {
+		if e, ok := b.pending[p]; ok {
+			events = append(events, e)
+			delete(b.pending, p)
+		}
+	}
+	b.order = b.order[:0]
+
+	deleted := b.deleted
+	b.deleted = 0
+
+	b.mu.Unlock()
+
+	for _, e := range events {
+		select {
+		case b.events <- e:
+		case <-b.close:
+			return
+		}
+	}
+
+	for i := 0; i < deleted; i++ {
+		select {
+		case b.errors <- watcher.ErrWatchedFileDeleted:
+		case <-b.close:
+			return
+		}
+	}
+}
+
+func (b *notifyBackend) WatchedFiles() map[string]os.FileInfo {
+	b.mu.Lock()
+
+	files := make(map[string]os.FileInfo, len(b.files))
+	for k, v := range b.files {
+		files[k] = v
+	}
+
+	fb := b.fallback
+
+	b.mu.Unlock()
+
+	if fb != nil {
+		for k, v := range fb.WatchedFiles() {
+			files[k] = v
+		}
+	}
+
+	return files
+}
+
+func (b *notifyBackend) Start(interval time.Duration) error {
+	if interval < time.Nanosecond {
+		return watcher.ErrDurationTooShort
+	}
+
+	b.mu.Lock()
+	if b.running {
+		b.mu.Unlock()
+		return watcher.ErrWatcherRunning
+	}
+
+	select {
+	case <-b.close:
+		b.mu.Unlock()
+		return nil
+	default:
+	}
+
+	b.running = true
+	b.interval = interval
+	fb := b.fallback
+	b.mu.Unlock()
+
+	defer close(b.closed)
+
+	if fb != nil {
+		go b.runFallback(fb, interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-b.close:
+			return nil
+		}
+	}
+}
+
+func (b *notifyBackend) Close() {
+	b.once.Do(func() {
+		b.mu.Lock()
+		close(b.close)
+		running := b.running
+		fb := b.fallback
+		b.mu.Unlock()
+
+		b.hub.detach(b)
+
+		if fb != nil {
+			fb.Close()
+		}
+
+		if !running {
+			close(b.closed)
+		}
+	})
+}
+
+// unsupportedFilesystem returns the name of the filesystem when changes made to it may never
+// be reported by the kernel, typically network and userspace filesystems
+func unsupportedFilesystem(path string) string {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return ""
+	}
+
+	switch uint32(st.Type) {
+	case unix.NFS_SUPER_MAGIC:
+		return "nfs"
+	case unix.FUSE_SUPER_MAGIC:
+		return "fuse"
+	case unix.SMB_SUPER_MAGIC, unix.SMB2_SUPER_MAGIC, unix.CIFS_SUPER_MAGIC:
+		return "smb"
+	case unix.V9FS_MAGIC:
+		return "9p"
+	case unix.CODA_SUPER_MAGIC:
+		return "coda"
+	case unix.AFS_SUPER_MAGIC:
+		return "afs"
+	case unix.CEPH_SUPER_MAGIC:
+		return "ceph"
+	}
+
+	return ""
+}
+
+func isUnder(path, dir string) bool {
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+
+	return strings.HasPrefix(path, dir)
+}
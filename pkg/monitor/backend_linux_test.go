@@ -0,0 +1,544 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"golang.org/x/sys/unix"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+const testInterval = 20 * time.Millisecond
+
+type backendStep struct {
+	do   func(t *testing.T, dir string)
+	want []string
+
+	// fanotify is what fanotify reports when it differs from want, it does not pair moves
+	fanotify []string
+}
+
+func TestNotifyBackend(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     []string
+		add       string
+		recursive bool
+		steps     []backendStep
+	}{
+		{
+			name: "create",
+			steps: []backendStep{{
+				do:   writeFile("a", "1"),
+				want: []string{"CREATE a"},
+			}},
+		},
+		{
+			name:  "write",
+			files: []string{"a"},
+			steps: []backendStep{{
+				do:   writeFile("a", "changed"),
+				want: []string{"WRITE a"},
+			}},
+		},
+		{
+			name:  "chmod",
+			files: []string{"a"},
+			steps: []backendStep{{
+				do: func(t *testing.T, dir string) {
+					if err := os.Chmod(filepath.Join(dir, "a"), 0o600); err != nil {
+						t.Fatal(err)
+					}
+				},
+				want: []string{"CHMOD a"},
+			}},
+		},
+		{
+			name:  "rename",
+			files: []string{"a"},
+			steps: []backendStep{{
+				do:       rename("a", "b"),
+				want:     []string{"RENAME a -> b"},
+				fanotify: []string{"CREATE b", "REMOVE a"},
+			}},
+		},
+		{
+			name:  "remove",
+			files: []string{"a"},
+			steps: []backendStep{{
+				do:   remove("a"),
+				want: []string{"REMOVE a"},
+			}},
+		},
+		{
+			name:  "moved out",
+			files: []string{"watched/a"},
+			add:   "watched",
+			steps: []backendStep{{
+				do: func(t *testing.T, dir string) {
+					rename("a", "../a")(t, filepath.Join(dir, "watched"))
+				},
+				want: []string{"REMOVE watched/a"},
+			}},
+		},
+		{
+			name:  "create and remove within an interval",
+			files: []string{"a"},
+			steps: []backendStep{{
+				do: func(t *testing.T, dir string) {
+					writeFile("b", "1")(t, dir)
+					remove("b")(t, dir)
+					writeFile("a", "changed")(t, dir)
+				},
+				want: []string{"WRITE a"},
+			}},
+		},
+		{
+			name:  "single file",
+			files: []string{"a", "b"},
+			add:   "a",
+			steps: []backendStep{{
+				do: func(t *testing.T, dir string) {
+					writeFile("b", "changed")(t, dir)
+					writeFile("a", "changed")(t, dir)
+				},
+				want: []string{"WRITE a"},
+			}},
+		},
+		{
+			name: "non recursive directory ignores subdirectories",
+			steps: []backendStep{{
+				do: func(t *testing.T, dir string) {
+					writeFile("sub/a", "1")(t, dir)
+					writeFile("b", "1")(t, dir)
+				},
+				want: []string{"CREATE b", "CREATE sub"},
+			}},
+		},
+		{
+			name:      "recursive subdirectory",
+			recursive: true,
+			steps: []backendStep{
+				{
+					do:   writeFile("sub/deeper/a", "1"),
+					want: []string{"CREATE sub", "CREATE sub/deeper", "CREATE sub/deeper/a"},
+				},
+				{
+					do:   writeFile("sub/deeper/a", "changed"),
+					want: []string{"WRITE sub/deeper/a"},
+				},
+				{
+					do:   remove("sub"),
+					want: []string{"REMOVE sub", "REMOVE sub/deeper", "REMOVE sub/deeper/a"},
+				},
+			},
+		},
+		{
+			name:      "existing recursive subdirectory",
+			files:     []string{"sub/a"},
+			recursive: true,
+			steps: []backendStep{{
+				do:   writeFile("sub/a", "changed"),
+				want: []string{"WRITE sub/a"},
+			}},
+		},
+	}
+
+	for _, name := range []string{config.BackendInotify, config.BackendFanotify} {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				for _, f := range tt.files {
+					writeFile(f, "initial")(t, dir)
+				}
+
+				hubs := newNotifyHubs()
+				t.Cleanup(hubs.close)
+
+				b, err := newNotifyBackend(hubs, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				root := filepath.Join(dir, tt.add)
+
+				add := b.Add
+				if tt.recursive {
+					add = b.AddRecursive
+				}
+
+				if err := add(root); err != nil {
+					t.Fatal(err)
+				}
+
+				startBackend(t, b)
+
+				_, fanotify := b.(*notifyBackend).hub.source.(*fanotifySource)
+
+				for i, step := range tt.steps {
+					step.do(t, dir)
+
+					want := step.want
+					if fanotify && step.fanotify != nil {
+						want = step.fanotify
+					}
+
+					if got := collectEvents(t, b, dir, len(want)); !reflect.DeepEqual(got, want) {
+						t.Fatalf("step %d: got %q, want %q", i, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestNotifyBackendSharesSource(t *testing.T) {
+	dir := t.TempDir()
+
+	hubs := newNotifyHubs()
+	t.Cleanup(hubs.close)
+
+	first, err := newNotifyBackend(hubs, config.BackendInotify)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := newNotifyBackend(hubs, config.BackendInotify)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.(*notifyBackend).hub != second.(*notifyBackend).hub {
+		t.Fatal("the backends do not share a hub")
+	}
+
+	for _, b := range []backend{first, second} {
+		if err := b.Add(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		startBackend(t, b)
+	}
+
+	writeFile("a", "1")(t, dir)
+
+	for _, b := range []backend{first, second} {
+		if got, want := collectEvents(t, b, dir, 1), []string{"CREATE a"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+
+	// the directory stays watched for the backend that is still open
+	first.Close()
+
+	writeFile("b", "1")(t, dir)
+
+	if got, want := collectEvents(t, second, dir, 1), []string{"CREATE b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// fakeSource hands the events written to it to a hub, it watches nothing
+type fakeSource struct {
+	events chan []rawEvent
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (s *fakeSource) watch(dir string) error { return nil }
+
+func (s *fakeSource) unwatch(dir string) {}
+
+func (s *fakeSource) read() ([]rawEvent, error) {
+	select {
+	case events := <-s.events:
+		return events, nil
+	case <-s.closed:
+		return nil, os.ErrClosed
+	}
+}
+
+func (s *fakeSource) close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+func TestNotifyBackendOverflow(t *testing.T) {
+	tests := []struct {
+		name string
+		do   func(t *testing.T, dir string)
+		want []string
+	}{
+		{
+			name: "unchanged",
+			do:   func(t *testing.T, dir string) {},
+		},
+		{
+			name: "created",
+			do:   writeFile("c", "1"),
+			want: []string{"CREATE c"},
+		},
+		{
+			name: "written",
+			do:   writeFile("a", "changed"),
+			want: []string{"WRITE a"},
+		},
+		{
+			name: "chmod",
+			do: func(t *testing.T, dir string) {
+				if err := os.Chmod(filepath.Join(dir, "a"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"CHMOD a"},
+		},
+		{
+			name: "removed",
+			do:   remove("b"),
+			want: []string{"REMOVE b"},
+		},
+		{
+			name: "removed subdirectory",
+			do:   remove("sub"),
+			want: []string{"REMOVE sub", "REMOVE sub/c"},
+		},
+		{
+			name: "new subdirectory",
+			do:   writeFile("new/c", "1"),
+			want: []string{"CREATE new", "CREATE new/c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range []string{"a", "b", "sub/c"} {
+				writeFile(f, "initial")(t, dir)
+			}
+
+			// the fake source reports nothing on its own, the changes are only found by the rescan
+			source := &fakeSource{events: make(chan []rawEvent), closed: make(chan struct{})}
+
+			hubs := &notifyHubs{hubs: map[string]*notifyHub{config.BackendInotify: newNotifyHub(source)}}
+			t.Cleanup(hubs.close)
+
+			b, err := newNotifyBackend(hubs, config.BackendInotify)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := b.AddRecursive(dir); err != nil {
+				t.Fatal(err)
+			}
+
+			startBackend(t, b)
+
+			tt.do(t, dir)
+			source.events <- []rawEvent{{op: rawOverflow}}
+
+			if got := collectEvents(t, b, dir, len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInotifySourceRead(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+
+	s := &inotifySource{
+		file:  r,
+		buf:   make([]byte, 64*1024),
+		wds:   map[int32]string{1: "/watched", 2: "/watched/sub"},
+		paths: map[string]int32{"/watched": 1, "/watched/sub": 2},
+	}
+	t.Cleanup(func() { _ = s.close() })
+
+	records := []struct {
+		wd     int32
+		mask   uint32
+		cookie uint32
+		name   string
+	}{
+		{wd: -1, mask: unix.IN_Q_OVERFLOW},
+		{wd: 1, mask: unix.IN_CREATE, name: "a"},
+		{wd: 1, mask: unix.IN_MODIFY, name: "a"},
+		{wd: 1, mask: unix.IN_CLOSE_WRITE, name: "a"},
+		{wd: 1, mask: unix.IN_ATTRIB, name: "a"},
+		{wd: 1, mask: unix.IN_MOVED_FROM, cookie: 7, name: "a"},
+		{wd: 1, mask: unix.IN_MOVED_TO, cookie: 7, name: "b"},
+		{wd: 1, mask: unix.IN_DELETE, name: "b"},
+		{wd: 3, mask: unix.IN_CREATE, name: "unknown"},
+		{wd: 2, mask: unix.IN_DELETE_SELF},
+		{wd: 2, mask: unix.IN_IGNORED},
+		{wd: 1, mask: unix.IN_CREATE | unix.IN_ISDIR, name: "a-name-longer-than-sixteen-bytes"},
+	}
+
+	var buf []byte
+	for _, rec := range records {
+		name := []byte(rec.name)
+		if len(name) > 0 {
+			// names are nul terminated and padded
+			name = append(name, make([]byte, 16-len(name)%16)...)
+		}
+
+		header := make([]byte, unix.SizeofInotifyEvent)
+		binary.NativeEndian.PutUint32(header[0:], uint32(rec.wd))
+		binary.NativeEndian.PutUint32(header[4:], rec.mask)
+		binary.NativeEndian.PutUint32(header[8:], rec.cookie)
+		binary.NativeEndian.PutUint32(header[12:], uint32(len(name)))
+
+		buf = append(buf, header...)
+		buf = append(buf, name...)
+	}
+
+	if _, err := w.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []rawEvent{
+		{op: rawOverflow},
+		{op: rawCreate, path: "/watched/a"},
+		{op: rawWrite, path: "/watched/a"},
+		{op: rawWrite, path: "/watched/a"},
+		{op: rawChmod, path: "/watched/a"},
+		{op: rawMovedFrom, path: "/watched/a", cookie: 7},
+		{op: rawMovedTo, path: "/watched/b", cookie: 7},
+		{op: rawRemove, path: "/watched/b"},
+		{op: rawRemove, path: "/watched/sub"},
+		{op: rawCreate, path: "/watched/a-name-longer-than-sixteen-bytes"},
+	}
+
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("got %+v, want %+v", events, want)
+	}
+
+	// the kernel dropped the watch of the removed directory
+	if _, ok := s.paths["/watched/sub"]; ok {
+		t.Fatal("the removed directory is still watched")
+	}
+}
+
+func startBackend(t *testing.T, b backend) {
+	t.Helper()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if err := b.Start(testInterval); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	t.Cleanup(func() {
+		b.Close()
+		<-done
+	})
+}
+
+// collectEvents waits for n events of b and any that follow within a few intervals. The events
+// are returned sorted, relative to dir. A change can be split over two intervals, a write to a
+// path that was already reported is then dropped as the backend does within one interval.
+func collectEvents(t *testing.T, b backend, dir string, n int) []string {
+	t.Helper()
+
+	var got []string
+	seen := map[string]bool{}
+
+	timeout := time.After(5 * time.Second)
+
+	for {
+		quiet := time.After(10 * testInterval)
+		if len(got) < n {
+			quiet = nil
+		}
+
+		select {
+		case e := <-b.Events():
+			path := relPath(dir, e.Path)
+			if (e.Op == watcher.Write || e.Op == watcher.Chmod) && seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			if e.Op == watcher.Rename {
+				got = append(got, fmt.Sprintf("%s %s -> %s", e.Op, relPath(dir, e.OldPath), path))
+				continue
+			}
+
+			got = append(got, fmt.Sprintf("%s %s", e.Op, path))
+		case err := <-b.Errors():
+			got = append(got, "ERROR "+err.Error())
+		case <-quiet:
+			sort.Strings(got)
+			return got
+		case <-timeout:
+			t.Fatalf("timed out waiting for %d events, got %q", n, got)
+		}
+	}
+}
+
+func relPath(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+
+	return rel
+}
+
+func writeFile(name, data string) func(t *testing.T, dir string) {
+	return func(t *testing.T, dir string) {
+		t.Helper()
+
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func rename(from, to string) func(t *testing.T, dir string) {
+	return func(t *testing.T, dir string) {
+		t.Helper()
+
+		if err := os.Rename(filepath.Join(dir, from), filepath.Join(dir, to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func remove(name string) func(t *testing.T, dir string) {
+	return func(t *testing.T, dir string) {
+		t.Helper()
+
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
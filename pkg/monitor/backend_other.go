@@ -0,0 +1,27 @@
+//go:build !linux
+
+package monitor
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/radovskyb/watcher"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+const defaultKernelBackend = config.BackendPoll
+
+// notifyHubs holds the kernel notification sources of a monitor, there are none on this platform
+type notifyHubs struct{}
+
+func newNotifyHubs() *notifyHubs {
+	return &notifyHubs{}
+}
+
+func (h *notifyHubs) close() {}
+
+func newNotifyBackend(hubs *notifyHubs, name string, filters ...watcher.FilterFileHookFunc) (backend, error) {
+	return nil, fmt.Errorf("backend %s is not supported on %s", name, runtime.GOOS)
+}
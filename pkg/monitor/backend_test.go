@@ -0,0 +1,21 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+func TestNewBackendPolls(t *testing.T) {
+	hubs := newNotifyHubs()
+	defer hubs.close()
+
+	// a monitor created from a config that was not loaded has no backend set
+	for _, name := range []string{"", config.BackendPoll} {
+		b := newBackend(hubs, name)
+		if _, ok := b.(*pollBackend); !ok {
+			t.Errorf("backend %q is a %T, want polling", name, b)
+		}
+		b.Close()
+	}
+}
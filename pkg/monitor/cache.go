@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+// cacheKey identifies a file by device and inode, or by path where inodes are not available
+type cacheKey struct {
+	dev   uint64
+	inode uint64
+	path  string
+}
+
+// fingerprint is the part of a stat that changes whenever the content of a file is written
+type fingerprint struct {
+	size  int64
+	mtime time.Time
+	ctime time.Time
+}
+
+func (f fingerprint) equal(o fingerprint) bool {
+	return f.size == o.size && f.mtime.Equal(o.mtime) && f.ctime.Equal(o.ctime)
+}
+
+type cacheEntry struct {
+	fingerprint
+
+	policy   hasher.Policy
+	result   *hasher.Result
+	hashedAt time.Time
+}
+
+// hashCache skips re-hashing files whose fingerprint has not changed since they were last hashed
+type hashCache struct {
+	metrics *metrics
+
+	// rehashInterval forces a full re-hash of unchanged files once it has elapsed, 0 disables it
+	rehashInterval atomic.Int64
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+	paths   map[string]cacheKey
+}
+
+func newHashCache(m *metrics) *hashCache {
+	return &hashCache{
+		metrics: m,
+		entries: map[cacheKey]*cacheEntry{},
+		paths:   map[string]cacheKey{},
+	}
+}
+
+func newCacheKey(path string, info os.FileInfo) cacheKey {
+	if dev, inode, ok := fileID(info); ok {
+		return cacheKey{dev: dev, inode: inode}
+	}
+
+	return cacheKey{path: path}
+}
+
+func newFingerprint(info os.FileInfo) fingerprint {
+	fp := fingerprint{
+		size:  info.Size(),
+		mtime: info.ModTime(),
+	}
+
+	if ctime, _, ok := statTimes(info); ok {
+		fp.ctime = ctime
+	}
+
+	return fp
+}
+
+// cached returns the digests of a file when its fingerprint is unchanged since it was last hashed
+func (c *hashCache) cached(path string, algorithm string, policy hasher.Policy, info os.FileInfo) *hasher.Result {
+	result := c.lookup(path, newCacheKey(path, info), algorithm, policy, newFingerprint(info))
+	if result != nil {
+		c.metrics.hashCacheHits.Inc()
+	}
+
+	return result
+}
+
+// store records the digests of a file along with the stat they were computed for
+func (c *hashCache) store(path string, info os.FileInfo, policy hasher.Policy, result *hasher.Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := newCacheKey(path, info)
+
+	c.entries[key] = &cacheEntry{
+		fingerprint: newFingerprint(info),
+		policy:      policy,
+		result:      result,
+		hashedAt:    time.Now(),
+	}
+	c.paths[path] = key
+}
+
+func (c *hashCache) lookup(path string, key cacheKey, algorithm string, policy hasher.Policy, fp fingerprint) *hasher.Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the path now points to a different inode, the old entry is stale
+	if old, ok := c.paths[path]; ok && old != key {
+		delete(c.entries, old)
+		delete(c.paths, path)
+	}
+
+	entry, ok := c.entries[key]
+	if !ok || !entry.fingerprint.equal(fp) || entry.result.Algorithm != algorithm || entry.policy != policy {
+		return nil
+	}
+
+	if interval := time.Duration(c.rehashInterval.Load()); interval > 0 && time.Since(entry.hashedAt) > interval {
+		return nil
+	}
+
+	return entry.result
+}
+
+// forget drops the entry of a path that is no longer monitored
+func (c *hashCache) forget(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.paths[path]; ok {
+		delete(c.entries, key)
+		delete(c.paths, path)
+	}
+}
@@ -0,0 +1,238 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+func TestHashCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := newMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newHashCache(m)
+	p := newPool(m, c, logrus.NewEntry(logrus.New()))
+
+	steps := []struct {
+		name      string
+		do        func(t *testing.T)
+		algorithm string
+		policy    hasher.Policy
+		rehash    time.Duration
+		hit       bool
+
+		// read is the number of bytes read on a miss when the policy does not read the whole file
+		read int64
+	}{
+		{
+			name:      "first hash",
+			algorithm: "sha256",
+		},
+		{
+			name:      "unchanged",
+			algorithm: "sha256",
+			hit:       true,
+		},
+		{
+			name: "same size rewritten",
+			do: func(t *testing.T) {
+				if err := os.WriteFile(path, []byte("CONTENT"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				later := time.Now().Add(time.Minute)
+				if err := os.Chtimes(path, later, later); err != nil {
+					t.Fatal(err)
+				}
+			},
+			algorithm: "sha256",
+		},
+		{
+			name: "size changed",
+			do: func(t *testing.T) {
+				if err := os.WriteFile(path, []byte("longer content"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			algorithm: "sha256",
+		},
+		{
+			name: "metadata changed",
+			do: func(t *testing.T) {
+				if err := os.Chmod(path, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			algorithm: "sha256",
+		},
+		{
+			name:      "other algorithm",
+			algorithm: "md5",
+		},
+		{
+			name:      "other policy",
+			algorithm: "md5",
+			policy:    hasher.Policy{Name: hasher.PolicyHeadTail, Bytes: 4},
+			read:      8,
+		},
+		{
+			name:      "same policy",
+			algorithm: "md5",
+			policy:    hasher.Policy{Name: hasher.PolicyHeadTail, Bytes: 4},
+			hit:       true,
+		},
+		{
+			name: "replaced by another inode",
+			do: func(t *testing.T) {
+				replacement := path + ".new"
+				if err := os.WriteFile(replacement, []byte("longer content"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Rename(replacement, path); err != nil {
+					t.Fatal(err)
+				}
+			},
+			algorithm: "md5",
+		},
+		{
+			name:      "unchanged within the rehash interval",
+			algorithm: "md5",
+			rehash:    time.Hour,
+			hit:       true,
+		},
+		{
+			name:      "rehash interval elapsed",
+			algorithm: "md5",
+			rehash:    time.Nanosecond,
+		},
+		{
+			name:      "forgotten",
+			do:        func(t *testing.T) { c.forget(path) },
+			algorithm: "md5",
+		},
+	}
+
+	for _, step := range steps {
+		if step.do != nil {
+			step.do(t)
+		}
+
+		c.rehashInterval.Store(int64(step.rehash))
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hits := testutil.ToFloat64(m.hashCacheHits)
+		misses := testutil.ToFloat64(m.hashCacheMisses)
+		hashed := testutil.ToFloat64(m.hashedBytes)
+
+		result := c.cached(path, step.algorithm, step.policy, info)
+		if result == nil {
+			result, err = p.hash(context.Background(), path, step.algorithm, step.policy)
+			if err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+
+			c.store(path, info, step.policy, result)
+		}
+
+		if result.Algorithm != step.algorithm {
+			t.Fatalf("%s: hashed with %s, want %s", step.name, result.Algorithm, step.algorithm)
+		}
+
+		if result.Policy != step.policy.String() {
+			t.Fatalf("%s: hashed with policy %q, want %q", step.name, result.Policy, step.policy)
+		}
+
+		gotHit := testutil.ToFloat64(m.hashCacheHits) > hits
+		gotMiss := testutil.ToFloat64(m.hashCacheMisses) > misses
+
+		if gotHit != step.hit || gotMiss == step.hit {
+			t.Fatalf("%s: hit %t, miss %t, want a hit %t", step.name, gotHit, gotMiss, step.hit)
+		}
+
+		wantBytes := 0.0
+		switch {
+		case step.hit:
+		case step.read > 0:
+			wantBytes = float64(step.read)
+		default:
+			wantBytes = float64(info.Size())
+		}
+
+		if got := testutil.ToFloat64(m.hashedBytes) - hashed; got != wantBytes {
+			t.Fatalf("%s: %v bytes hashed, want %v", step.name, got, wantBytes)
+		}
+
+		// an entry is kept per file, replaced ones are dropped
+		if len(c.entries) > 1 || len(c.paths) > 1 {
+			t.Fatalf("%s: the cache holds %d entries for %d paths", step.name, len(c.entries), len(c.paths))
+		}
+	}
+}
+
+func TestPoolCancelledJobNotCached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := newMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newHashCache(m)
+	p := newPool(m, c, logrus.NewEntry(logrus.New()))
+
+	r := &rule{Path: config.Path{Path: path, Hash: "sha256"}}
+
+	for _, cancelled := range []bool{true, false} {
+		job := &hashJob{rule: r, path: path, metricPath: path, info: info}
+
+		p.run(context.Background(), job)
+		<-p.results
+
+		// the file is removed once it has been hashed but before the result is applied
+		if cancelled {
+			p.mu.Lock()
+			p.active[path] = job
+			p.mu.Unlock()
+
+			p.cancel(path)
+		}
+
+		called := false
+		applied := p.apply(job, func(*hashJob) { called = true })
+
+		if applied != !cancelled || called != !cancelled {
+			t.Fatalf("cancelled %t: applied %t, called %t", cancelled, applied, called)
+		}
+
+		if cached := c.cached(path, "sha256", hasher.Policy{}, info) != nil; cached == cancelled {
+			t.Fatalf("cancelled %t: result cached %t", cancelled, cached)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+func TestContentChanges(t *testing.T) {
+	const metricPath = "/test/content-changes"
+
+	steps := []struct {
+		name    string
+		result  hasher.Result
+		removed bool
+		changes float64
+	}{
+		{
+			name:    "first digest",
+			result:  hasher.Result{CRC32: 1, Algorithm: "sha256", Digest: "a", Policy: hasher.PolicyFull},
+			changes: 0,
+		},
+		{
+			name:    "same digest",
+			result:  hasher.Result{CRC32: 1, Algorithm: "sha256", Digest: "a", Policy: hasher.PolicyFull},
+			changes: 0,
+		},
+		{
+			name:    "digest differs",
+			result:  hasher.Result{CRC32: 2, Algorithm: "sha256", Digest: "b", Policy: hasher.PolicyFull},
+			changes: 1,
+		},
+		{
+			name:    "other algorithm",
+			result:  hasher.Result{CRC32: 2, Algorithm: "sha1", Digest: "c", Policy: hasher.PolicyFull},
+			changes: 1,
+		},
+		{
+			name:    "other policy",
+			result:  hasher.Result{CRC32: 3, Algorithm: "sha1", Digest: "d", Policy: "sample:16x4096"},
+			changes: 1,
+		},
+		{
+			name:    "skipped",
+			result:  hasher.Result{Algorithm: "sha1", Policy: hasher.PolicySkip},
+			changes: 1,
+		},
+		{
+			name:    "hashed again after skip",
+			result:  hasher.Result{CRC32: 4, Algorithm: "sha1", Digest: "e", Policy: "sample:16x4096"},
+			changes: 1,
+		},
+		{
+			name:    "digest differs again",
+			result:  hasher.Result{CRC32: 5, Algorithm: "sha1", Digest: "f", Policy: "sample:16x4096"},
+			changes: 2,
+		},
+		{
+			name:    "other policy parameters",
+			result:  hasher.Result{CRC32: 7, Algorithm: "sha1", Digest: "h", Policy: "sample:8x4096"},
+			changes: 2,
+		},
+		{
+			name:    "removed keeps the counter",
+			removed: true,
+			changes: 2,
+		},
+		{
+			name:    "recreated",
+			result:  hasher.Result{CRC32: 6, Algorithm: "sha1", Digest: "g", Policy: "sample:16x4096"},
+			changes: 2,
+		},
+	}
+
+	metrics, err := newMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Monitor{
+		metrics: metrics,
+		state:   newStateStore(metrics.trackedFiles, nil),
+	}
+
+	for _, step := range steps {
+		if step.removed {
+			m.deleteMetrics(metricPath)
+		} else {
+			result := step.result
+			m.applyHash(metricPath, &result)
+		}
+
+		if got := testutil.ToFloat64(metrics.fileContentChanges.WithLabelValues(metricPath)); got != step.changes {
+			t.Fatalf("%s: file_content_changes_total = %v, want %v", step.name, got, step.changes)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package monitor
+
+import (
+	"io/fs"
+	"time"
+
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+// Event is a change to a monitored file, paths are reported without the rootfs
+type Event struct {
+	Time time.Time `json:"time"`
+
+	// Op is the operation as exported on file_event: CREATE, WRITE, REMOVE, RENAME, CHMOD, MOVE
+	// or offline_change
+	Op string `json:"op"`
+
+	Path string `json:"path"`
+
+	// OldPath is the previous path of a renamed or moved file
+	OldPath string `json:"old_path,omitempty"`
+
+	// Before is the last digest of the file before the event, After the digest once the event was
+	// applied. Either is nil when the file was not hashed, events that change the content are
+	// published once the file has been hashed again.
+	Before *hasher.Result `json:"before,omitempty"`
+	After  *hasher.Result `json:"after,omitempty"`
+
+	// BeforeStat and AfterStat are the metadata of the file before and after the event, either is
+	// nil when the file did not exist or was not tracked
+	BeforeStat *FileStat `json:"before_stat,omitempty"`
+	AfterStat  *FileStat `json:"after_stat,omitempty"`
+}
+
+// FileStat is the metadata of a file at the time of an event
+type FileStat struct {
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mod_time"`
+
+	// UID and GID are nil on platforms that do not report them
+	UID *uint64 `json:"uid,omitempty"`
+	GID *uint64 `json:"gid,omitempty"`
+}
+
+func newFileStat(info fs.FileInfo) *FileStat {
+	if info == nil {
+		return nil
+	}
+
+	stat := &FileStat{
+		Size:    info.Size(),
+		Mode:    info.Mode().String(),
+		ModTime: info.ModTime(),
+	}
+
+	if details, ok := statDetails(info); ok {
+		stat.UID = &details.uid
+		stat.GID = &details.gid
+	}
+
+	return stat
+}
+
+// Recorder keeps a record of every event. Unlike subscribers recorders are called as events are
+// published so none is missed, Record must be safe for concurrent use and should return quickly.
+type Recorder interface {
+	Record(event Event) error
+}
+
+// subscriber is a channel returned by Subscribe, name labels the events dropped for it and dropped
+// counts them
+type subscriber struct {
+	name    string
+	ch      chan Event
+	dropped uint64
+}
+
+// Subscribe returns a channel that receives every event handled by the monitor. Events are dropped
+// rather than holding up the monitor when the channel is full and are counted in
+// file_exporter_subscriber_dropped_events_total with the name of the subscriber. The channel is
+// closed by Unsubscribe or once the monitor has stopped.
+func (m *Monitor) Subscribe(name string, buffer int) <-chan Event {
+	ch := make(chan Event, buffer)
+
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	if m.subClosed {
+		close(ch)
+		return ch
+	}
+
+	m.subscribers[ch] = &subscriber{name: name, ch: ch}
+
+	return ch
+}
+
+// Dropped returns the number of events dropped so far because a channel returned by Subscribe was
+// full, 0 once it has been closed
+func (m *Monitor) Dropped(ch <-chan Event) uint64 {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	if sub, ok := m.subscribers[ch]; ok {
+		return sub.dropped
+	}
+
+	return 0
+}
+
+// Unsubscribe stops delivering events to a channel returned by Subscribe and closes it
+func (m *Monitor) Unsubscribe(ch <-chan Event) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	if sub, ok := m.subscribers[ch]; ok {
+		delete(m.subscribers, ch)
+		close(sub.ch)
+	}
+}
+
+func (m *Monitor) publish(event Event) {
+	m.history.add(event)
+
+	for _, r := range m.recorders {
+		if err := r.Record(event); err != nil {
+			m.logEntry.WithError(err).WithField("path", event.Path).WithField("op", event.Op).Error("unable to record event")
+		}
+	}
+
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	for _, sub := range m.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped++
+			m.metrics.subscriberDropped.WithLabelValues(sub.name).Inc()
+			m.logEntry.WithField("subscriber", sub.name).WithField("path", event.Path).WithField("op", event.Op).Debug("subscriber is full, dropping event")
+		}
+	}
+}
+
+func (m *Monitor) closeSubscribers() {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	for ch, sub := range m.subscribers {
+		delete(m.subscribers, ch)
+		close(sub.ch)
+	}
+
+	m.subClosed = true
+}
@@ -0,0 +1,187 @@
+package monitor
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+// EventFilter selects events from the history, zero values match everything
+type EventFilter struct {
+	// Prefix matches events whose path or old path starts with it
+	Prefix string
+
+	// Ops matches events with any of the operations
+	Ops []string
+
+	// Since and Until bound the time of the events, both are inclusive
+	Since time.Time
+	Until time.Time
+
+	// Limit keeps only the most recent events
+	Limit int
+}
+
+// Match reports whether an event is selected by the filter
+func (f EventFilter) Match(event Event) bool {
+	if f.Prefix != "" && !strings.HasPrefix(event.Path, f.Prefix) && (event.OldPath == "" || !strings.HasPrefix(event.OldPath, f.Prefix)) {
+		return false
+	}
+
+	if len(f.Ops) > 0 && !f.matchOp(event.Op) {
+		return false
+	}
+
+	if !f.Since.IsZero() && event.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && event.Time.After(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+func (f EventFilter) matchOp(op string) bool {
+	for _, o := range f.Ops {
+		if strings.EqualFold(o, op) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// history is a ring buffer of the most recent events
+type history struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// setSize resizes the buffer keeping the most recent events, 0 disables it
+func (h *history) setSize(size int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if size == len(h.events) {
+		return
+	}
+
+	events := h.ordered()
+	if len(events) > size {
+		events = events[len(events)-size:]
+	}
+
+	h.events = make([]Event, size)
+	h.next = copy(h.events, events)
+	h.full = h.next == size
+
+	if h.full {
+		h.next = 0
+	}
+}
+
+func (h *history) add(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.events) == 0 {
+		return
+	}
+
+	h.events[h.next] = event
+	h.next = (h.next + 1) % len(h.events)
+
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the events selected by the filter, oldest first
+func (h *history) list(filter EventFilter) []Event {
+	h.mu.Lock()
+	events := h.ordered()
+	h.mu.Unlock()
+
+	selected := make([]Event, 0, len(events))
+	for _, event := range events {
+		if filter.Match(event) {
+			selected = append(selected, event)
+		}
+	}
+
+	if filter.Limit > 0 && len(selected) > filter.Limit {
+		selected = selected[len(selected)-filter.Limit:]
+	}
+
+	return selected
+}
+
+// ordered returns a copy of the events oldest first, h.mu must be held
+func (h *history) ordered() []Event {
+	if !h.full {
+		return append([]Event(nil), h.events[:h.next]...)
+	}
+
+	events := make([]Event, 0, len(h.events))
+	events = append(events, h.events[h.next:]...)
+	events = append(events, h.events[:h.next]...)
+
+	return events
+}
+
+// Events returns the most recent events selected by the filter, oldest first
+func (m *Monitor) Events(filter EventFilter) []Event {
+	return m.history.list(filter)
+}
+
+// hold keeps an event back until the hash of its file is applied so it can be published with
+// the digest after the change, a previous event still held for the file is published as is
+func (m *Monitor) hold(event Event) {
+	m.heldMu.Lock()
+	previous, ok := m.held[event.Path]
+	m.held[event.Path] = event
+	m.heldMu.Unlock()
+
+	if ok {
+		m.publish(previous)
+	}
+}
+
+// release publishes the event held for a file, with the digest after the change when it was hashed
+// and the latest stat of the file
+func (m *Monitor) release(metricPath string, after *hasher.Result) {
+	m.heldMu.Lock()
+	event, ok := m.held[metricPath]
+	delete(m.held, metricPath)
+	m.heldMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	event.After = after
+
+	if state, ok := m.state.get(metricPath); ok {
+		event.AfterStat = newFileStat(state.info)
+	}
+
+	m.publish(event)
+}
+
+// releaseAll publishes every event still held, without the digest after the change
+func (m *Monitor) releaseAll() {
+	m.heldMu.Lock()
+	held := m.held
+	m.held = map[string]Event{}
+	m.heldMu.Unlock()
+
+	for _, event := range held {
+		m.publish(event)
+	}
+}
@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventFilter(t *testing.T) {
+	now := time.Now()
+
+	events := []Event{
+		{Time: now.Add(-3 * time.Minute), Op: "CREATE", Path: "/etc/app/a"},
+		{Time: now.Add(-2 * time.Minute), Op: "WRITE", Path: "/etc/app/a"},
+		{Time: now.Add(-time.Minute), Op: "RENAME", Path: "/srv/b", OldPath: "/etc/app/b"},
+		{Time: now, Op: "REMOVE", Path: "/srv/c"},
+	}
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   []int
+	}{
+		{
+			name: "everything",
+			want: []int{0, 1, 2, 3},
+		},
+		{
+			name:   "prefix",
+			filter: EventFilter{Prefix: "/srv/"},
+			want:   []int{2, 3},
+		},
+		{
+			name:   "prefix of the old path",
+			filter: EventFilter{Prefix: "/etc/app/"},
+			want:   []int{0, 1, 2},
+		},
+		{
+			name:   "ops",
+			filter: EventFilter{Ops: []string{"CREATE", "REMOVE"}},
+			want:   []int{0, 3},
+		},
+		{
+			name:   "ops ignore case",
+			filter: EventFilter{Ops: []string{"write"}},
+			want:   []int{1},
+		},
+		{
+			name:   "since is inclusive",
+			filter: EventFilter{Since: now.Add(-time.Minute)},
+			want:   []int{2, 3},
+		},
+		{
+			name:   "until is inclusive",
+			filter: EventFilter{Until: now.Add(-2 * time.Minute)},
+			want:   []int{0, 1},
+		},
+		{
+			name:   "limit keeps the most recent",
+			filter: EventFilter{Limit: 2},
+			want:   []int{2, 3},
+		},
+		{
+			name:   "everything combined",
+			filter: EventFilter{Prefix: "/etc/", Ops: []string{"WRITE", "RENAME"}, Since: now.Add(-5 * time.Minute), Until: now, Limit: 1},
+			want:   []int{2},
+		},
+		{
+			name:   "nothing matches",
+			filter: EventFilter{Prefix: "/var/"},
+			want:   []int{},
+		},
+	}
+
+	h := &history{}
+	h.setSize(len(events))
+
+	for _, event := range events {
+		h.add(event)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := make([]Event, 0, len(tt.want))
+			for _, i := range tt.want {
+				want = append(want, events[i])
+			}
+
+			if got := h.list(tt.filter); !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", opsOf(got), opsOf(want))
+			}
+		})
+	}
+}
+
+func TestHistorySize(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		added   int
+		resize  int
+		wantOps []string
+	}{
+		{
+			name:  "disabled",
+			added: 3,
+		},
+		{
+			name:    "not full",
+			size:    5,
+			added:   3,
+			wantOps: []string{"0", "1", "2"},
+		},
+		{
+			name:    "oldest are overwritten",
+			size:    3,
+			added:   5,
+			wantOps: []string{"2", "3", "4"},
+		},
+		{
+			name:    "shrinking keeps the most recent",
+			size:    5,
+			added:   7,
+			resize:  2,
+			wantOps: []string{"5", "6"},
+		},
+		{
+			name:    "growing keeps every event",
+			size:    2,
+			added:   3,
+			resize:  4,
+			wantOps: []string{"1", "2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &history{}
+			h.setSize(tt.size)
+
+			for i := 0; i < tt.added; i++ {
+				h.add(Event{Op: string(rune('0' + i))})
+			}
+
+			if tt.resize > 0 {
+				h.setSize(tt.resize)
+			}
+
+			if got := opsOf(h.list(EventFilter{})); !reflect.DeepEqual(got, tt.wantOps) {
+				t.Fatalf("history holds %v, want %v", got, tt.wantOps)
+			}
+		})
+	}
+}
+
+func opsOf(events []Event) []string {
+	var ops []string
+	for _, event := range events {
+		ops = append(ops, event.Op)
+	}
+
+	return ops
+}
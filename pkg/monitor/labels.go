@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelsCollector exposes the static labels configured for a path as a file_labels_info metric.
+// Label names differ between paths so the metric is built at collection time rather than
+// through a GaugeVec with a fixed set of label names.
+type labelsCollector struct {
+	mu     sync.RWMutex
+	labels map[string]map[string]string
+}
+
+func newLabelsCollector() *labelsCollector {
+	return &labelsCollector{
+		labels: map[string]map[string]string{},
+	}
+}
+
+func (c *labelsCollector) set(path string, labels map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(labels) == 0 {
+		delete(c.labels, path)
+		return
+	}
+
+	c.labels[path] = labels
+}
+
+func (c *labelsCollector) delete(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.labels, path)
+}
+
+// Describe sends no descriptors which makes this an unchecked collector
+func (c *labelsCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *labelsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for path, labels := range c.labels {
+		names := make([]string, 0, len(labels)+1)
+		for k := range labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		values := make([]string, 0, len(names)+1)
+		for _, k := range names {
+			values = append(values, labels[k])
+		}
+
+		names = append(names, "path")
+		values = append(values, path)
+
+		desc := prometheus.NewDesc("file_labels_info", "Static labels configured for the path", names, nil)
+		metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, 1, values...)
+		if err != nil {
+			metric = prometheus.NewInvalidMetric(desc, err)
+		}
+
+		ch <- metric
+	}
+}
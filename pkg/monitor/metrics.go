@@ -0,0 +1,277 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+// metrics holds every collector of a monitor so several monitors can be registered on different registries
+type metrics struct {
+	fileStatModified          *prometheus.GaugeVec
+	fileStatChange            *prometheus.GaugeVec
+	fileStatAccess            *prometheus.GaugeVec
+	filePermissions           *prometheus.GaugeVec
+	fileContentHashCRC32      *prometheus.GaugeVec
+	fileContentHashInfo       *prometheus.GaugeVec
+	fileContentChanges        *prometheus.CounterVec
+	fileContentLastChange     *prometheus.GaugeVec
+	fileEvent                 *prometheus.CounterVec
+	fileChangedWhileOffline   *prometheus.GaugeVec
+	filePendingPaths          prometheus.Gauge
+	filePendingRecursivePaths prometheus.Gauge
+	pathState                 *prometheus.GaugeVec
+	fileExists                *prometheus.GaugeVec
+	fileMissingSince          *prometheus.GaugeVec
+	fileLabels                *labelsCollector
+
+	fileSize            *prometheus.GaugeVec
+	fileOwnerUID        *prometheus.GaugeVec
+	fileOwnerGID        *prometheus.GaugeVec
+	fileInode           *prometheus.GaugeVec
+	fileHardLinks       *prometheus.GaugeVec
+	fileAllocatedBlocks *prometheus.GaugeVec
+	fileType            *prometheus.GaugeVec
+
+	hashCacheHits   prometheus.Counter
+	hashCacheMisses prometheus.Counter
+	hashedBytes     prometheus.Counter
+	hashQueueDepth  prometheus.Gauge
+	hashDuration    *prometheus.HistogramVec
+	trackedFiles    prometheus.Gauge
+
+	subscriberDropped *prometheus.CounterVec
+}
+
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		fileStatModified: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_stat_modified_time_seconds",
+			Help: "The unix time the file was last modified",
+		}, []string{"path"}),
+
+		fileStatChange: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_stat_change_time_seconds",
+			Help: "The unix time the file's inode was last changed",
+		}, []string{"path"}),
+
+		fileStatAccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_stat_access_time_seconds",
+			Help: "The unix time the file was last accessed",
+		}, []string{"path"}),
+
+		filePermissions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_permissions",
+			Help: "The permissions of a file",
+		}, []string{"path"}),
+
+		fileContentHashCRC32: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_content_hash_crc32",
+			Help: "The CRC32 Hash of the file's content",
+		}, []string{"path"}),
+
+		fileContentHashInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_content_hash_info",
+			Help: "The digest of the file's content using the configured algorithm, policy tells which parts of the file were hashed and its parameters",
+		}, []string{"path", "algorithm", "digest", "policy"}),
+
+		fileContentChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_content_changes_total",
+			Help: "Number of times the file's content hash differed from the previous one",
+		}, []string{"path"}),
+
+		fileContentLastChange: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_content_last_change_timestamp_seconds",
+			Help: "The time a change to the file's content hash was last seen",
+		}, []string{"path"}),
+
+		fileEvent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_event",
+			Help: "Events that occur against a file",
+		}, []string{"path", "op"}),
+
+		fileChangedWhileOffline: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_changed_while_offline",
+			Help: "Whether the file differed at startup from the state saved when the exporter last stopped",
+		}, []string{"path"}),
+
+		filePendingPaths: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "file_pending_paths",
+			Help: "Paths that are pending monitoring, usually because they were initially not found",
+		}),
+
+		filePendingRecursivePaths: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "file_pending_recursive_paths",
+			Help: "Paths that are pending monitoring, usually because they were initially not found",
+		}),
+
+		pathState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_exporter_path_state",
+			Help: "The state of a configured path: active, pending, errored or permission_denied",
+		}, []string{"path", "state"}),
+
+		fileExists: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_exists",
+			Help: "Whether a configured path exists (1) or is missing (0)",
+		}, []string{"path"}),
+
+		fileMissingSince: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_missing_since_timestamp_seconds",
+			Help: "The time a configured path was first found missing, only present while it is missing",
+		}, []string{"path"}),
+
+		fileLabels: newLabelsCollector(),
+
+		fileSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_size_bytes",
+			Help: "The size of the file in bytes",
+		}, []string{"path"}),
+
+		fileOwnerUID: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_owner_uid",
+			Help: "The user id of the file's owner",
+		}, []string{"path"}),
+
+		fileOwnerGID: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_owner_gid",
+			Help: "The group id of the file's group",
+		}, []string{"path"}),
+
+		fileInode: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_inode",
+			Help: "The inode number of the file",
+		}, []string{"path"}),
+
+		fileHardLinks: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_hard_links",
+			Help: "The number of hard links to the file",
+		}, []string{"path"}),
+
+		fileAllocatedBlocks: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_allocated_blocks_bytes",
+			Help: "The number of bytes allocated on disk for the file",
+		}, []string{"path"}),
+
+		fileType: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "file_type",
+			Help: "The type of the file: regular, directory, symlink, fifo, socket, block_device, char_device or other",
+		}, []string{"path", "type"}),
+
+		hashCacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_exporter_hash_cache_hits_total",
+			Help: "Number of times a file was not re-hashed because its fingerprint did not change",
+		}),
+
+		hashCacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_exporter_hash_cache_misses_total",
+			Help: "Number of times a file had to be hashed",
+		}),
+
+		hashedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_exporter_hashed_bytes_total",
+			Help: "Number of bytes read while hashing files",
+		}),
+
+		hashQueueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "file_exporter_hash_queue_depth",
+			Help: "Number of files waiting to be hashed",
+		}),
+
+		hashDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "file_exporter_hash_duration_seconds",
+			Help:    "Time taken to hash a file, including time spent waiting on the I/O budget",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"algorithm"}),
+
+		trackedFiles: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "file_exporter_tracked_files",
+			Help: "Number of files whose state is held in memory",
+		}),
+
+		subscriberDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_exporter_subscriber_dropped_events_total",
+			Help: "Events dropped because a subscriber, a sink or a stream client, did not keep up with the monitor",
+		}, []string{"subscriber"}),
+	}
+
+	collectors := []prometheus.Collector{
+		m.fileStatModified,
+		m.fileStatChange,
+		m.fileStatAccess,
+		m.filePermissions,
+		m.fileContentHashCRC32,
+		m.fileContentHashInfo,
+		m.fileContentChanges,
+		m.fileContentLastChange,
+		m.fileEvent,
+		m.fileChangedWhileOffline,
+		m.filePendingPaths,
+		m.filePendingRecursivePaths,
+		m.pathState,
+		m.fileExists,
+		m.fileMissingSince,
+		m.fileLabels,
+		m.fileSize,
+		m.fileOwnerUID,
+		m.fileOwnerGID,
+		m.fileInode,
+		m.fileHardLinks,
+		m.fileAllocatedBlocks,
+		m.fileType,
+		m.hashCacheHits,
+		m.hashCacheMisses,
+		m.hashedBytes,
+		m.hashQueueDepth,
+		m.hashDuration,
+		m.trackedFiles,
+		m.subscriberDropped,
+	}
+
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *metrics) statVec(name string) *prometheus.GaugeVec {
+	switch name {
+	case config.StatSize:
+		return m.fileSize
+	case config.StatUID:
+		return m.fileOwnerUID
+	case config.StatGID:
+		return m.fileOwnerGID
+	case config.StatInode:
+		return m.fileInode
+	case config.StatLinks:
+		return m.fileHardLinks
+	case config.StatBlocks:
+		return m.fileAllocatedBlocks
+	case config.StatType:
+		return m.fileType
+	}
+
+	return nil
+}
+
+// deleteFile removes the series describing the current state of a file. file_event and
+// file_content_changes_total are kept since the file may come back and consumers rely on them
+// being monotonic, they are only deleted once the file is no longer monitored.
+func (m *metrics) deleteFile(metricPath string) {
+	m.fileContentHashCRC32.DeleteLabelValues(metricPath)
+	m.fileContentHashInfo.DeletePartialMatch(prometheus.Labels{"path": metricPath})
+	m.fileContentLastChange.DeleteLabelValues(metricPath)
+	m.fileChangedWhileOffline.DeleteLabelValues(metricPath)
+	m.fileStatModified.DeleteLabelValues(metricPath)
+	m.fileStatChange.DeleteLabelValues(metricPath)
+	m.fileStatAccess.DeleteLabelValues(metricPath)
+	m.filePermissions.DeleteLabelValues(metricPath)
+	m.fileLabels.delete(metricPath)
+
+	for _, name := range config.StatMetrics {
+		m.statVec(name).DeletePartialMatch(prometheus.Labels{"path": metricPath})
+	}
+}
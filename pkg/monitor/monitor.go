@@ -2,361 +2,606 @@ package monitor
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"hash/crc32"
-	"io"
-	"io/fs"
 	"os"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/radovskyb/watcher"
 	"github.com/sirupsen/logrus"
-	"github.com/urfave/cli/v2"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
 )
 
-var pendingSync sync.Mutex
+// Options configures a Monitor
+type Options struct {
+	// Config holds the paths to monitor and how to monitor them
+	Config *config.Config
 
-var (
-	fileStatModified = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "file_stat_modified_time_seconds",
-		Help: "The unix time the file was last modified",
-	}, []string{"path"})
+	// Registerer is where the monitor's metrics are registered, defaults to prometheus.DefaultRegisterer
+	Registerer prometheus.Registerer
 
-	filePermissions = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "file_permissions",
-		Help: "The permissions of a file",
-	}, []string{"path"})
+	// Logger defaults to the standard logrus logger
+	Logger *logrus.Logger
 
-	fileContentHashCRC32 = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "file_content_hash_crc32",
-		Help: "The CRC32 Hash of the file's content",
-	}, []string{"path"})
+	// Recorders are given every event before subscribers, in the order they are published
+	Recorders []Recorder
+}
 
-	fileEvent = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "file_event",
-		Help: "Events that occur against a file",
-	}, []string{"path", "op"})
+// Monitor watches a set of paths and exports metrics about the files in them
+type Monitor struct {
+	logEntry *logrus.Entry
+	metrics  *metrics
+	hashes   *hashCache
+	state    *stateStore
+	pool     *pool
+
+	// legacyModifiedTime reports the time a change was noticed instead of the file's modification time
+	legacyModifiedTime atomic.Bool
+
+	// enabledStats holds a map[string]bool of the optional stat metrics that are exported
+	enabledStats atomic.Value
+
+	events chan ruleEvent
+	errs   chan ruleError
+	wg     sync.WaitGroup
+
+	stopOnce sync.Once
+
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped bool
+	rootfs  string
+	backend string
+	rules   []*rule
+
+	// hubs share one kernel notification source between the watchers of every rule
+	hubs *notifyHubs
+
+	// paths holds the state of the path of every rule, retry wakes the path loop for a rule whose
+	// pending path may have been created
+	pathsMu sync.Mutex
+	paths   map[*rule]*pathStatus
+	retry   chan *rule
+
+	// stateFile is where the state is saved across restarts, offline holds the saved state of the
+	// files that have not been compared since startup
+	stateFile string
+	offlineMu sync.Mutex
+	offline   map[string]savedFile
+
+	recorders []Recorder
+
+	subMu       sync.Mutex
+	subscribers map[<-chan Event]*subscriber
+	subClosed   bool
+
+	// history keeps the most recent events, held are the events waiting on the hash of their file
+	history history
+	heldMu  sync.Mutex
+	held    map[string]Event
+}
 
-	filePendingPaths = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "file_pending_paths",
-		Help: "Paths that are pending monitoring, usually because they were initially not found",
-	})
+// New creates a monitor for the paths of the config and registers its metrics, nothing is
+// watched until Start is called
+func New(opts Options) (*Monitor, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		return nil, errors.New("a config is required")
+	}
 
-	filePendingRecursivePaths = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "file_pending_recursive_paths",
-		Help: "Paths that are pending monitoring, usually because they were initially not found",
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	reg := opts.Registerer
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	log := opts.Logger
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+
+	metrics, err := newMetrics(reg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to register metrics: %w", err)
+	}
+
+	m := &Monitor{
+		logEntry:    log.WithField("component", "monitor"),
+		metrics:     metrics,
+		hashes:      newHashCache(metrics),
+		events:      make(chan ruleEvent),
+		errs:        make(chan ruleError),
+		paths:       map[*rule]*pathStatus{},
+		retry:       make(chan *rule, 1),
+		subscribers: map[<-chan Event]*subscriber{},
+		held:        map[string]Event{},
+		hubs:        newNotifyHubs(),
+		recorders:   opts.Recorders,
+	}
+
+	m.pool = newPool(metrics, m.hashes, m.logEntry)
+
+	// an evicted file is hashed again the next time it is seen
+	m.state = newStateStore(metrics.trackedFiles, func(state *fileState) {
+		m.hashes.forget(state.path)
 	})
 
-	pendingPaths          []string
-	pendingRecursivePaths []string
-	fileInfoCache         = map[string]fs.FileInfo{}
-)
+	for _, p := range cfg.Paths {
+		p.ApplyDefaults(config.Path{})
+
+		r, err := newRule(p, cfg.RootFS, cfg.Backend, m.hubs)
+		if err != nil {
+			m.hubs.close()
+			return nil, err
+		}
+
+		m.rules = append(m.rules, r)
+	}
 
-func New(ctx context.Context, c *cli.Context, log *logrus.Logger) error {
-	logEntry := log.WithField("component", "monitor")
+	m.configure(cfg)
 
-	w := watcher.New()
+	if cfg.StateFile != "" {
+		m.stateFile = cfg.StateFile
 
-	if c.String("regex") != "" {
-		r, err := regexp.Compile(c.String("regex"))
+		saved, err := loadSavedState(cfg.StateFile)
 		if err != nil {
-			return err
+			m.logEntry.WithError(err).Error("unable to load state, offline changes will not be detected")
+			saved = &savedState{Files: map[string]savedFile{}}
 		}
 
-		w.AddFilterHook(watcher.RegexFilterHook(r, c.Bool("regex-full-path")))
+		m.offline = saved.Files
+	}
+
+	return m, nil
+}
+
+// configure applies the settings of the config that are not specific to a path
+func (m *Monitor) configure(cfg *config.Config) {
+	m.rootfs = cfg.RootFS
+	m.backend = cfg.Backend
+
+	m.legacyModifiedTime.Store(cfg.LegacyModifiedTime)
+	m.setStatMetrics(cfg.StatMetrics)
+	m.hashes.rehashInterval.Store(int64(cfg.RehashInterval.Duration))
+	m.state.setLimit(cfg.MaxTrackedFiles)
+	m.history.setSize(cfg.EventHistory)
+	m.pool.configure(cfg.HashWorkers, cfg.HashBytesPerSecond)
+}
+
+// Start watches the paths and exports the metrics of every file found, it returns once the
+// initial scan is done. The monitor is stopped when the context is done.
+func (m *Monitor) Start(ctx context.Context) error {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return errors.New("monitor has been stopped")
+	}
+	if m.ctx != nil {
+		m.mu.Unlock()
+		return errors.New("monitor is already started")
 	}
 
+	m.ctx, m.cancel = context.WithCancel(ctx)
+
+	rules := make([]*rule, len(m.rules))
+	copy(rules, m.rules)
+
+	m.wg.Add(2)
+	if m.stateFile != "" {
+		m.wg.Add(1)
+		go m.persistLoop()
+	}
+	m.mu.Unlock()
+
+	m.pool.start(m.ctx)
+
+	go m.eventLoop()
+	go m.pathLoop()
+
 	go func() {
-		for {
-			select {
-			case event := <-w.Event:
-				if event.FileInfo == nil {
-					logEntry.WithField("op", event.Op).WithField("path", event.Path).Error("file info empty, this should not happen")
-					continue
-				}
+		<-m.ctx.Done()
+		m.Stop()
+	}()
 
-				if event.IsDir() {
-					continue
-				}
+	m.startRules(rules)
+	m.checkOfflineRemovals()
 
-				metricPath := event.Path
-				if c.String("rootfs") != "" {
-					metricPath = strings.ReplaceAll(metricPath, c.String("rootfs"), "")
-				}
+	m.logEntry.Info("starting watcher")
 
-				metricPath = filepath.ToSlash(filepath.Clean(metricPath))
+	return nil
+}
 
-				fileInfoCache[event.Path] = event.FileInfo
+// Stop closes every watcher and waits for them to finish, subscriptions are closed once it returns
+func (m *Monitor) Stop() {
+	m.stopOnce.Do(func() {
+		m.mu.Lock()
+		m.stopped = true
+		cancel := m.cancel
+		rules := m.rules
+		m.mu.Unlock()
+
+		if cancel != nil {
+			cancel()
+		}
 
-				logEntry.WithField("path", metricPath).WithField("op", event.Op).Debug("event received")
+		for _, r := range rules {
+			r.watcher.Close()
+			m.removePathStatus(r)
+		}
 
-				if event.Op == watcher.Remove {
-					fileEvent.WithLabelValues(metricPath, event.Op.String()).Inc()
+		m.pool.stop()
+		m.wg.Wait()
+		m.hubs.close()
 
-					fileContentHashCRC32.DeleteLabelValues(metricPath)
-					fileStatModified.DeleteLabelValues(metricPath)
-					filePermissions.DeleteLabelValues(metricPath)
+		m.saveState()
 
-					delete(fileInfoCache, metricPath)
-				} else if event.Op == watcher.Rename {
-					oldMetricPath := event.OldPath
-					if c.String("rootfs") != "" {
-						oldMetricPath = strings.ReplaceAll(oldMetricPath, c.String("rootfs"), "")
-					}
-					oldMetricPath = filepath.ToSlash(filepath.Clean(oldMetricPath))
+		m.releaseAll()
+		m.closeSubscribers()
+	})
+}
 
-					fileEvent.WithLabelValues(oldMetricPath, event.Op.String()).Inc()
+// running reports whether the monitor has been started and not stopped since
+func (m *Monitor) running() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-					fileContentHashCRC32.DeleteLabelValues(oldMetricPath)
-					fileStatModified.DeleteLabelValues(oldMetricPath)
-					filePermissions.DeleteLabelValues(oldMetricPath)
+	return m.ctx != nil && !m.stopped
+}
 
-					generateMetrics(metricPath, c.String("rootfs"))
+func (m *Monitor) snapshot() []*rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-					delete(fileInfoCache, oldMetricPath)
-				} else {
-					fileEvent.WithLabelValues(metricPath, event.Op.String()).Inc()
-					generateMetrics(metricPath, c.String("rootfs"))
-				}
-			case err := <-w.Error:
-				logEntry.WithError(err).Error("watch error")
-				if err == watcher.ErrWatchedFileDeleted {
-					paths := c.StringSlice("path")
-					splitPaths := strings.Split(c.String("paths"), ",")
-					if len(splitPaths) > 0 && len(splitPaths[0]) > 0 {
-						paths = append(paths, splitPaths...)
-					}
-
-					var missingPaths []string
-					for _, path := range paths {
-						path := filepath.ToSlash(filepath.Clean(path))
-
-						log := logEntry.WithField("path", path).WithField("component", "missing-file")
-						log.Trace("processing path")
-						if i, err := os.Stat(path); err != nil && os.IsNotExist(err) {
-							if v, ok := fileInfoCache[path]; ok {
-								i = v
-								log.Trace("file cache: hit")
-							} else {
-								log.Trace("file cache: miss")
-							}
-
-							missingPaths = append(missingPaths, path)
-							go func() {
-								w.Event <- watcher.Event{Op: watcher.Remove, Path: path, FileInfo: i}
-							}()
-
-							log.Trace("triggered remove event")
-						}
-					}
-
-					addWatcherPaths(w, logEntry, c.String("rootfs"), missingPaths)
-				}
+	rules := make([]*rule, len(m.rules))
+	copy(rules, m.rules)
 
-			case <-w.Closed:
-				return
-			case <-ctx.Done():
-				return
-			}
+	return rules
+}
+
+// startRules adds the paths of the rules to their watchers, exports the metrics of the files
+// found and starts the watchers
+func (m *Monitor) startRules(rules []*rule) {
+	for _, r := range rules {
+		go r.forward(m.ctx, m.events, m.errs)
+		m.addAll(r)
+	}
+
+	m.runWatchedFiles(rules)
+
+	for _, r := range rules {
+		m.start(r, r.watcher)
+	}
+}
+
+// start runs a watcher at the rule's interval until it is closed
+func (m *Monitor) start(r *rule, b backend) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		if err := b.Start(r.Interval.Duration); err != nil {
+			m.logEntry.WithField("path", r.Path.Path).Error(err)
 		}
 	}()
+}
 
-	go func() {
-		filePendingPaths.Set(float64(len(pendingPaths)))
-		filePendingRecursivePaths.Set(float64(len(pendingRecursivePaths)))
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(30 * time.Second):
-				pendingSync.Lock()
-
-				logEntry.Debug("processing pending paths")
-				for i, path := range pendingPaths {
-					if err := w.Add(path); err != nil {
-						logEntry.WithField("path", path).WithError(err).Error("unable to add path for watching (pending-path, retry)")
-						continue
-					}
-					logEntry.WithField("path", path).Debug("successfully adding pending path")
-					pendingPaths = append(pendingPaths[:i], pendingPaths[i+1:]...)
-				}
+func (m *Monitor) eventLoop() {
+	defer m.wg.Done()
 
-				for i, path := range pendingRecursivePaths {
-					if err := w.AddRecursive(path); err != nil {
-						logEntry.WithField("path", path).WithError(err).Error("unable to add file for watching (pending-recursive-path, retry)")
-						continue
-					}
-					logEntry.WithField("path", path).Info("successfully adding pending path")
-					pendingRecursivePaths = append(pendingRecursivePaths[:i], pendingRecursivePaths[i+1:]...)
+	for {
+		select {
+		case re := <-m.events:
+			m.handleEvent(re.rule, re.event)
+		case re := <-m.errs:
+			m.handleError(re.rule, re.err)
+		case job := <-m.pool.results:
+			applied := m.pool.apply(job, func(job *hashJob) {
+				if job.result != nil {
+					m.exportHash(job.metricPath, job.result)
 				}
+			})
 
-				pendingSync.Unlock()
+			// recorders may write to disk, the pool is not held up while they do
+			if applied {
+				m.publishHash(job.metricPath, job.result)
+			}
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
 
-				runWatchedFiles(w, logEntry, c.String("rootfs"))
+// addAll adds the rule's path (or every match of its glob) to the watcher
+func (m *Monitor) addAll(r *rule) {
+	path := r.absPath(m.logEntry)
 
-				filePendingPaths.Set(float64(len(pendingPaths)))
-				filePendingRecursivePaths.Set(float64(len(pendingRecursivePaths)))
-			}
+	if r.glob {
+		m.expandGlob(r)
+
+		var err error
+		if len(r.watchedPaths()) == 0 {
+			err = os.ErrNotExist
 		}
-	}()
 
-	if len(c.String("paths")) > 0 {
-		addWatcherPaths(w, logEntry, c.String("rootfs"), strings.Split(c.String("paths"), ","))
+		m.setPathState(r, path, err)
+		return
 	}
 
-	addWatcherPaths(w, logEntry, c.String("rootfs"), c.StringSlice("path"))
+	m.logEntry.WithField("path", path).WithField("recursive", r.Recursive).Debug("monitored path")
 
-	if len(c.String("recursive-paths")) > 0 {
-		for _, f := range strings.Split(c.String("recursive-paths"), ",") {
-			path := filepath.Join(c.String("rootfs"), f)
-			abs, err := filepath.Abs(path)
-			if err != nil {
-				logEntry.WithError(err).Error("unable to get abs path")
-			} else {
-				path = abs
-			}
+	err := r.add(path)
+	if err != nil {
+		m.logEntry.WithField("path", path).WithError(err).Error("unable to add path for watching")
+	}
 
-			logEntry.WithField("path", path).Debug("monitored path recursively")
-			if err := w.AddRecursive(path); err != nil {
-				pendingRecursivePaths = append(pendingRecursivePaths, path)
-				logEntry.WithField("path", path).WithError(err).Error("unable to add file for watching")
-			}
-		}
+	m.setPathState(r, path, err)
+}
+
+// expandGlob adds any matches of the rule's glob that are not yet watched
+func (m *Monitor) expandGlob(r *rule) {
+	pattern := r.absPath(m.logEntry)
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		m.logEntry.WithField("path", pattern).WithError(err).Error("unable to expand glob")
+		return
 	}
 
-	for _, d := range c.StringSlice("recursive-path") {
-		path := filepath.Join(c.String("rootfs"), d)
-		abs, err := filepath.Abs(path)
-		if err != nil {
-			logEntry.WithError(err).Error("unable to get abs path")
-		} else {
-			path = abs
+	if len(matches) == 0 {
+		m.logEntry.WithField("path", pattern).Debug("glob has no matches")
+	}
+
+	watched := r.watchedPaths()
+
+	for _, match := range matches {
+		if slices.Contains(watched, match) {
+			continue
 		}
 
-		logEntry.WithField("path", path).Debug("recursive path monitor")
-		if err := w.AddRecursive(path); err != nil {
-			pendingRecursivePaths = append(pendingRecursivePaths, path)
-			logEntry.WithError(err).WithField("path", path).Error("unable to add directory for recursive watch")
+		m.logEntry.WithField("path", match).WithField("glob", pattern).Debug("monitored path from glob")
+		if err := r.add(match); err != nil {
+			m.logEntry.WithField("path", match).WithError(err).Error("unable to add path for watching")
 		}
 	}
+}
 
-	runWatchedFiles(w, logEntry, c.String("rootfs"))
+func (m *Monitor) handleEvent(r *rule, event watcher.Event) {
+	if event.FileInfo == nil {
+		m.logEntry.WithField("op", event.Op).WithField("path", event.Path).Error("file info empty, this should not happen")
+		return
+	}
+
+	if event.IsDir() {
+		return
+	}
 
-	logEntry.Info("starting watcher")
+	metricPath := toMetricPath(event.Path, r.rootfs)
 
-	// Start the watching process - it'll check for changes every 5 seconds.
-	if err := w.Start(time.Millisecond * 100); err != nil {
-		logEntry.Error(err)
+	m.logEntry.WithField("path", metricPath).WithField("op", event.Op).Debug("event received")
+
+	published := Event{
+		Time: time.Now(),
+		Op:   event.Op.String(),
+		Path: metricPath,
 	}
 
-	return nil
-}
+	if state, ok := m.state.get(metricPath); ok {
+		published.Before = state.digest
+		published.BeforeStat = newFileStat(state.info)
+	}
 
-func addWatcherPaths(w *watcher.Watcher, logEntry *logrus.Entry, rootfs string, paths []string) {
-	for _, f := range paths {
-		path := filepath.Join(rootfs, f)
-		abs, err := filepath.Abs(path)
-		if err != nil {
-			logEntry.WithError(err).Error("unable to get abs path")
-		} else {
-			path = abs
-		}
+	if event.Op == watcher.Remove {
+		m.metrics.fileEvent.WithLabelValues(metricPath, event.Op.String()).Inc()
+
+		m.pool.cancel(event.Path)
+		m.deleteMetrics(metricPath)
+		m.hashes.forget(event.Path)
+
+		m.publish(published)
+		return
+	}
 
-		logEntry.WithField("path", path).Debug("monitored path from paths")
-		if err := w.Add(path); err != nil {
-			pendingPaths = append(pendingPaths, path)
-			logEntry.WithField("path", path).WithError(err).Error("unable to add file for watching")
+	if event.Op == watcher.Rename {
+		oldMetricPath := toMetricPath(event.OldPath, r.rootfs)
+		published.OldPath = oldMetricPath
+
+		if state, ok := m.state.get(oldMetricPath); ok {
+			published.Before = state.digest
+			published.BeforeStat = newFileStat(state.info)
 		}
+
+		m.metrics.fileEvent.WithLabelValues(oldMetricPath, event.Op.String()).Inc()
+
+		m.pool.cancel(event.OldPath)
+		m.deleteMetrics(oldMetricPath)
+		m.hashes.forget(event.OldPath)
+	} else {
+		m.metrics.fileEvent.WithLabelValues(metricPath, event.Op.String()).Inc()
+	}
+
+	m.hold(published)
+	m.generateMetrics(r, event.Path)
+	m.state.recordEvent(metricPath, published.Op, published.Time)
+
+	// the hash was served from the cache, or the file is not hashed at all
+	if !m.pool.busy(event.Path) {
+		m.release(metricPath, nil)
 	}
 }
 
-func runWatchedFiles(w *watcher.Watcher, logEntry *logrus.Entry, rootfs string) {
-	logrus.Debug("processing all watched files")
-	for path, f := range w.WatchedFiles() {
-		if f.IsDir() {
+func (m *Monitor) handleError(r *rule, err error) {
+	m.logEntry.WithError(err).WithField("rule", r.Path.Path).Error("watch error")
+	if err != watcher.ErrWatchedFileDeleted {
+		return
+	}
+
+	for _, path := range r.watchedPaths() {
+		log := m.logEntry.WithField("path", path).WithField("component", "missing-file")
+		log.Trace("processing path")
+
+		i, err := os.Stat(path)
+		if err == nil || !os.IsNotExist(err) {
 			continue
 		}
 
-		logEntry.WithField("path", path).Debug("watched file")
+		m.markPending(r, path)
+
+		// recursive watches emit remove events for their own contents
+		if r.Recursive {
+			continue
+		}
+
+		if state, ok := m.state.get(toMetricPath(path, r.rootfs)); ok && state.info != nil {
+			i = state.info
+			log.Trace("file cache: hit")
+		} else {
+			log.Trace("file cache: miss")
+		}
+
+		m.handleEvent(r, watcher.Event{Op: watcher.Remove, Path: path, FileInfo: i})
 
-		path = filepath.ToSlash(filepath.Clean(path))
-		fileInfoCache[path] = f
-		generateMetrics(path, rootfs)
+		log.Trace("triggered remove event")
 	}
+
+	m.updatePendingMetrics()
 }
 
-func generateMetrics(path string, rootfs string) {
+func (m *Monitor) runWatchedFiles(rules []*rule) {
+	m.logEntry.Debug("processing all watched files")
+	for _, r := range rules {
+		for path, f := range r.watcher.WatchedFiles() {
+			if f.IsDir() {
+				continue
+			}
+
+			m.logEntry.WithField("path", path).Debug("watched file")
+
+			m.generateMetrics(r, filepath.ToSlash(filepath.Clean(path)))
+		}
+	}
+}
+
+func toMetricPath(path string, rootfs string) string {
 	metricPath := path
 	if rootfs != "" {
 		metricPath = strings.ReplaceAll(metricPath, rootfs, "")
 	}
 
-	metricPath = filepath.ToSlash(filepath.Clean(metricPath))
+	return filepath.ToSlash(filepath.Clean(metricPath))
+}
 
-	fileStatModified.WithLabelValues(metricPath).SetToCurrentTime()
+// deleteMetrics removes the series describing the current state of a file
+func (m *Monitor) deleteMetrics(metricPath string) {
+	m.release(metricPath, nil)
+	m.metrics.deleteFile(metricPath)
+	m.state.delete(metricPath)
+}
 
-	crc32val, err := generateCRC32(path)
-	if err != nil {
-		logrus.WithError(err).Error("unable to generate crc32")
-		return
-	}
+func (m *Monitor) generateMetrics(r *rule, path string) {
+	metricPath := toMetricPath(path, r.rootfs)
 
-	fileContentHashCRC32.WithLabelValues(metricPath).Set(float64(*crc32val))
+	m.metrics.fileLabels.set(metricPath, r.getLabels())
 
 	stats, err := os.Stat(path)
 	if err != nil {
-		logrus.WithError(err).Error("unable to get file stats")
+		m.logEntry.WithError(err).Error("unable to get file stats")
 		return
 	}
 
+	m.state.setInfo(metricPath, path, stats, r)
+
+	if m.legacyModifiedTime.Load() {
+		m.metrics.fileStatModified.WithLabelValues(metricPath).SetToCurrentTime()
+	} else {
+		m.metrics.fileStatModified.WithLabelValues(metricPath).Set(toSeconds(stats.ModTime()))
+	}
+
+	if ctime, atime, ok := statTimes(stats); ok {
+		m.metrics.fileStatChange.WithLabelValues(metricPath).Set(toSeconds(ctime))
+		m.metrics.fileStatAccess.WithLabelValues(metricPath).Set(toSeconds(atime))
+	}
+
+	m.generateStatMetrics(metricPath, path, stats)
+
+	// reading a fifo or device would block or never end
+	if stats.Mode().IsRegular() {
+		policy := r.policy(stats.Size())
+
+		if policy.Name == hasher.PolicySkip {
+			m.pool.cancel(path)
+			m.applyHash(metricPath, &hasher.Result{Algorithm: r.Hash, Policy: policy.String()})
+		} else if result := m.hashes.cached(path, r.Hash, policy, stats); result != nil {
+			m.applyHash(metricPath, result)
+		} else {
+			m.pool.submit(r, path, metricPath, stats, policy)
+		}
+	}
+
 	perms := fmt.Sprintf("%#o", stats.Mode().Perm())
 	i, err := strconv.Atoi(perms)
 	if err != nil {
-		logrus.WithError(err).Error("unable to convert string to int")
+		m.logEntry.WithError(err).Error("unable to convert string to int")
 		return
 	}
 
-	filePermissions.WithLabelValues(metricPath).Set(float64(i))
+	m.metrics.filePermissions.WithLabelValues(metricPath).Set(float64(i))
 }
 
-func generateCRC32(path string) (*uint32, error) {
-	hash := crc32.NewIEEE()
+// applyHash exports the digests of a file and publishes the events waiting on them
+func (m *Monitor) applyHash(metricPath string, result *hasher.Result) {
+	m.exportHash(metricPath, result)
+	m.publishHash(metricPath, result)
+}
 
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
+// publishHash publishes a change made while offline and the event held for a file once it was
+// hashed, result is nil when hashing failed
+func (m *Monitor) publishHash(metricPath string, result *hasher.Result) {
+	if result != nil {
+		m.checkOffline(metricPath, result)
 	}
-	defer file.Close()
-
-	// read chunks of 32k
-	buf := make([]byte, 32*1024)
 
-	for {
-		c, err := file.Read(buf)
-		slice := buf[:c]
-		if _, errHash := hash.Write(slice); errHash != nil {
-			return nil, err
-		}
+	m.release(metricPath, result)
+}
 
-		if err == io.EOF {
-			break
-		}
+// exportHash exports the digests of a file, a skipped file only reports its policy
+func (m *Monitor) exportHash(metricPath string, result *hasher.Result) {
+	m.metrics.fileContentHashInfo.DeletePartialMatch(prometheus.Labels{"path": metricPath})
+	m.metrics.fileContentHashInfo.WithLabelValues(metricPath, result.Algorithm, result.Digest, result.Policy).Set(1)
 
-		if err != nil {
-			logrus.Debugln("Error reading content of file", path, "-", err)
-			return nil, err
-		}
+	if result.Policy == hasher.PolicySkip {
+		m.metrics.fileContentHashCRC32.DeleteLabelValues(metricPath)
+		m.state.setDigest(metricPath, result)
+		return
 	}
 
-	val := hash.Sum32()
+	m.metrics.fileContentHashCRC32.WithLabelValues(metricPath).Set(float64(result.CRC32))
+
+	if m.state.observe(metricPath, result) {
+		m.metrics.fileContentChanges.WithLabelValues(metricPath).Inc()
+		m.metrics.fileContentLastChange.WithLabelValues(metricPath).SetToCurrentTime()
+	}
+}
 
-	return &val, nil
+func toSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
 }
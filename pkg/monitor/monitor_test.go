@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+// gatherPaths returns the path label of every series of the metric
+func gatherPaths(t *testing.T, g prometheus.Gatherer, name string) []string {
+	t.Helper()
+
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "path" {
+					paths = append(paths, label.GetValue())
+				}
+			}
+		}
+	}
+
+	return paths
+}
+
+func TestMonitorRegistries(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	tests := []struct {
+		name     string
+		registry *prometheus.Registry
+		file     string
+	}{
+		{
+			name:     "first",
+			registry: prometheus.NewRegistry(),
+			file:     filepath.Join(t.TempDir(), "first"),
+		},
+		{
+			name:     "second",
+			registry: prometheus.NewRegistry(),
+			file:     filepath.Join(t.TempDir(), "second"),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tt := range tests {
+		if err := os.WriteFile(tt.file, []byte(tt.name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		mon, err := New(Options{
+			Config: &config.Config{
+				Paths: []config.Path{{Path: filepath.Dir(tt.file)}},
+			},
+			Registerer: tt.registry,
+			Logger:     log,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if err := mon.Start(ctx); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		defer mon.Stop()
+	}
+
+	for _, tt := range tests {
+		want := []string{filepath.ToSlash(tt.file)}
+		if got := gatherPaths(t, tt.registry, "file_permissions"); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: file_permissions exported for %v, want %v", tt.name, got, want)
+		}
+	}
+
+	// the collectors of a monitor can only be registered once per registry
+	_, err := New(Options{
+		Config: &config.Config{
+			Paths: []config.Path{{Path: filepath.Dir(tests[0].file)}},
+		},
+		Registerer: tests[0].registry,
+		Logger:     log,
+	})
+	if err == nil {
+		t.Error("a second monitor was registered on the same registry")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	mon, err := New(Options{
+		Config:     &config.Config{Paths: []config.Path{{Path: t.TempDir()}}},
+		Registerer: prometheus.NewRegistry(),
+		Logger:     log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow := mon.Subscribe("slow", 1)
+	fast := mon.Subscribe("fast", 4)
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		mon.publish(Event{Op: "WRITE", Path: path})
+	}
+
+	if got := len(slow); got != 1 {
+		t.Errorf("slow subscriber received %d events, want 1", got)
+	}
+
+	if got := len(fast); got != 3 {
+		t.Errorf("fast subscriber received %d events, want 3", got)
+	}
+
+	for name, want := range map[string]float64{"slow": 2, "fast": 0} {
+		if got := testutil.ToFloat64(mon.metrics.subscriberDropped.WithLabelValues(name)); got != want {
+			t.Errorf("dropped %v events for %s, want %v", got, name, want)
+		}
+	}
+
+	if got := mon.Dropped(slow); got != 2 {
+		t.Errorf("dropped %d events for the slow subscriber, want 2", got)
+	}
+
+	if got := mon.Dropped(fast); got != 0 {
+		t.Errorf("dropped %d events for the fast subscriber, want 0", got)
+	}
+
+	// events still queued are received before the channel is closed
+	mon.Unsubscribe(slow)
+
+	if event, ok := <-slow; !ok || event.Path != "/a" {
+		t.Errorf("received %+v, want the first event", event)
+	}
+
+	if _, ok := <-slow; ok {
+		t.Error("the channel is still open after Unsubscribe")
+	}
+}
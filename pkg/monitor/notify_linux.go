@@ -0,0 +1,343 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE |
+	unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_ATTRIB | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF |
+	unix.IN_ONLYDIR | unix.IN_EXCL_UNLINK
+
+// inotifySource watches individual directories, every directory consumes one of the
+// user's fs.inotify.max_user_watches
+type inotifySource struct {
+	fd   int
+	file *os.File
+	buf  []byte
+
+	mu    sync.Mutex
+	wds   map[int32]string
+	paths map[string]int32
+}
+
+func newInotifySource() (*inotifySource, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	return &inotifySource{
+		fd:    fd,
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		buf:   make([]byte, 64*1024),
+		wds:   map[int32]string{},
+		paths: map[string]int32{},
+	}, nil
+}
+
+func (s *inotifySource) watch(dir string) error {
+	wd, err := unix.InotifyAddWatch(s.fd, dir, inotifyMask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wds[int32(wd)] = dir
+	s.paths[dir] = int32(wd)
+
+	return nil
+}
+
+func (s *inotifySource) unwatch(dir string) {
+	s.mu.Lock()
+	wd, ok := s.paths[dir]
+	if ok {
+		delete(s.paths, dir)
+		delete(s.wds, wd)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		_, _ = unix.InotifyRmWatch(s.fd, uint32(wd))
+	}
+}
+
+func (s *inotifySource) read() ([]rawEvent, error) {
+	n, err := s.file.Read(s.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []rawEvent
+
+	for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+		wd := int32(binary.NativeEndian.Uint32(s.buf[offset:]))
+		mask := binary.NativeEndian.Uint32(s.buf[offset+4:])
+		cookie := binary.NativeEndian.Uint32(s.buf[offset+8:])
+		length := int(binary.NativeEndian.Uint32(s.buf[offset+12:]))
+
+		name := s.buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+length]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+
+		offset += unix.SizeofInotifyEvent + length
+
+		if mask&unix.IN_Q_OVERFLOW != 0 {
+			events = append(events, rawEvent{op: rawOverflow})
+			continue
+		}
+
+		s.mu.Lock()
+		dir, ok := s.wds[wd]
+		if mask&unix.IN_IGNORED != 0 && ok {
+			delete(s.wds, wd)
+			if s.paths[dir] == wd {
+				delete(s.paths, dir)
+			}
+		}
+		s.mu.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		path := dir
+		if len(name) > 0 {
+			path = filepath.Join(dir, string(name))
+		}
+
+		switch {
+		case mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0:
+			events = append(events, rawEvent{op: rawRemove, path: dir})
+		case mask&unix.IN_DELETE != 0:
+			events = append(events, rawEvent{op: rawRemove, path: path})
+		case mask&unix.IN_MOVED_FROM != 0:
+			events = append(events, rawEvent{op: rawMovedFrom, path: path, cookie: cookie})
+		case mask&unix.IN_MOVED_TO != 0:
+			events = append(events, rawEvent{op: rawMovedTo, path: path, cookie: cookie})
+		case mask&unix.IN_CREATE != 0:
+			events = append(events, rawEvent{op: rawCreate, path: path})
+		case mask&(unix.IN_MODIFY|unix.IN_CLOSE_WRITE) != 0:
+			events = append(events, rawEvent{op: rawWrite, path: path})
+		case mask&unix.IN_ATTRIB != 0:
+			events = append(events, rawEvent{op: rawChmod, path: path})
+		}
+	}
+
+	return events, nil
+}
+
+func (s *inotifySource) close() error {
+	return s.file.Close()
+}
+
+const fanotifyMask = unix.FAN_CREATE | unix.FAN_DELETE | unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO |
+	unix.FAN_MODIFY | unix.FAN_CLOSE_WRITE | unix.FAN_ATTRIB | unix.FAN_ONDIR
+
+// fanotifyMetadataSize is the size of struct fanotify_event_metadata
+const fanotifyMetadataSize = 24
+
+// fanotifySource marks whole filesystems so it is not bound by the inotify watch limit, it
+// requires CAP_SYS_ADMIN and a kernel with FAN_REPORT_DFID_NAME (5.9+). Moves are reported
+// as a removal and a creation since fanotify does not pair them.
+type fanotifySource struct {
+	fd   int
+	file *os.File
+	buf  []byte
+
+	// mounts holds a directory per marked filesystem used to resolve file handles
+	mu     sync.Mutex
+	mounts map[unix.Fsid]int
+}
+
+func newFanotifySource() (*fanotifySource, error) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK|unix.FAN_REPORT_DFID_NAME, unix.O_RDONLY|unix.O_LARGEFILE|unix.O_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("fanotify_init", err)
+	}
+
+	return &fanotifySource{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "fanotify"),
+		buf:    make([]byte, 64*1024),
+		mounts: map[unix.Fsid]int{},
+	}, nil
+}
+
+func (s *fanotifySource) watch(dir string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return os.NewSyscallError("statfs", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.mounts[st.Fsid]; ok {
+		return nil
+	}
+
+	if err := unix.FanotifyMark(s.fd, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, fanotifyMask, unix.AT_FDCWD, dir); err != nil {
+		return os.NewSyscallError("fanotify_mark", err)
+	}
+
+	mfd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return os.NewSyscallError("open", err)
+	}
+
+	s.mounts[st.Fsid] = mfd
+
+	return nil
+}
+
+// unwatch does nothing, the filesystem mark is shared by every path on it
+func (s *fanotifySource) unwatch(dir string) {}
+
+func (s *fanotifySource) read() ([]rawEvent, error) {
+	n, err := s.file.Read(s.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []rawEvent
+
+	for offset := 0; offset+fanotifyMetadataSize <= n; {
+		length := int(binary.NativeEndian.Uint32(s.buf[offset:]))
+		metaLength := int(binary.NativeEndian.Uint16(s.buf[offset+6:]))
+		mask := binary.NativeEndian.Uint64(s.buf[offset+8:])
+		fd := int32(binary.NativeEndian.Uint32(s.buf[offset+16:]))
+
+		if length < fanotifyMetadataSize || offset+length > n {
+			break
+		}
+
+		record := s.buf[offset : offset+length]
+		offset += length
+
+		if fd >= 0 {
+			_ = unix.Close(int(fd))
+		}
+
+		if mask&unix.FAN_Q_OVERFLOW != 0 {
+			events = append(events, rawEvent{op: rawOverflow})
+			continue
+		}
+
+		path, ok := s.resolve(record[metaLength:])
+		if !ok {
+			continue
+		}
+
+		// a record may merge several changes, removals go first so the final state wins
+		if mask&unix.FAN_DELETE != 0 {
+			events = append(events, rawEvent{op: rawRemove, path: path})
+		}
+		if mask&unix.FAN_MOVED_FROM != 0 {
+			events = append(events, rawEvent{op: rawMovedFrom, path: path})
+		}
+		if mask&(unix.FAN_CREATE|unix.FAN_MOVED_TO) != 0 {
+			events = append(events, rawEvent{op: rawCreate, path: path})
+		}
+		if mask&(unix.FAN_MODIFY|unix.FAN_CLOSE_WRITE) != 0 {
+			events = append(events, rawEvent{op: rawWrite, path: path})
+		}
+		if mask&unix.FAN_ATTRIB != 0 {
+			events = append(events, rawEvent{op: rawChmod, path: path})
+		}
+	}
+
+	return events, nil
+}
+
+// resolve turns the directory file handle and name of an event into a path
+func (s *fanotifySource) resolve(info []byte) (string, bool) {
+	for len(info) >= 4 {
+		infoType := info[0]
+		length := int(binary.NativeEndian.Uint16(info[2:]))
+		if length < 4 || length > len(info) {
+			return "", false
+		}
+
+		record := info[:length]
+		info = info[length:]
+
+		if infoType != unix.FAN_EVENT_INFO_TYPE_DFID_NAME && infoType != unix.FAN_EVENT_INFO_TYPE_DFID {
+			continue
+		}
+
+		// header (4), fsid (8), handle_bytes (4), handle_type (4), f_handle, name
+		if len(record) < 20 {
+			return "", false
+		}
+
+		fsid := unix.Fsid{Val: [2]int32{
+			int32(binary.NativeEndian.Uint32(record[4:])),
+			int32(binary.NativeEndian.Uint32(record[8:])),
+		}}
+		handleBytes := int(binary.NativeEndian.Uint32(record[12:]))
+		handleType := int32(binary.NativeEndian.Uint32(record[16:]))
+
+		if len(record) < 20+handleBytes {
+			return "", false
+		}
+
+		handle := record[20 : 20+handleBytes]
+
+		var name string
+		if infoType == unix.FAN_EVENT_INFO_TYPE_DFID_NAME {
+			rest := record[20+handleBytes:]
+			if i := bytes.IndexByte(rest, 0); i >= 0 {
+				name = string(rest[:i])
+			}
+		}
+
+		s.mu.Lock()
+		mfd, ok := s.mounts[fsid]
+		s.mu.Unlock()
+
+		if !ok {
+			return "", false
+		}
+
+		fd, err := unix.OpenByHandleAt(mfd, unix.NewFileHandle(handleType, handle), unix.O_PATH|unix.O_CLOEXEC)
+		if err != nil {
+			return "", false
+		}
+
+		dir, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+		_ = unix.Close(fd)
+		if err != nil {
+			return "", false
+		}
+
+		if name == "" || name == "." {
+			return dir, true
+		}
+
+		return filepath.Join(dir, name), true
+	}
+
+	return "", false
+}
+
+func (s *fanotifySource) close() error {
+	s.mu.Lock()
+	for _, fd := range s.mounts {
+		_ = unix.Close(fd)
+	}
+	s.mounts = map[unix.Fsid]int{}
+	s.mu.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,370 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sans-sroc/file_exporter/pkg/retry"
+)
+
+// States a configured path moves through
+const (
+	// PathActive is a path that is being watched
+	PathActive = "active"
+
+	// PathPending is a path that does not exist yet
+	PathPending = "pending"
+
+	// PathErrored is a path that could not be watched for any other reason
+	PathErrored = "errored"
+
+	// PathPermissionDenied is a path the exporter is not allowed to read
+	PathPermissionDenied = "permission_denied"
+)
+
+// PathStates lists every state of a path
+var PathStates = []string{PathActive, PathPending, PathErrored, PathPermissionDenied}
+
+const (
+	// retryBase is the delay before the first retry of a path that could not be watched
+	retryBase = time.Second
+
+	// retryMax caps the delay between retries
+	retryMax = 5 * time.Minute
+
+	// resyncInterval is how often globs are expanded again and every file is refreshed
+	resyncInterval = 30 * time.Second
+)
+
+// pathStatus is the state of the path of a rule, or of its glob
+type pathStatus struct {
+	// path is the absolute path on disk, or the glob pattern
+	path string
+
+	state    string
+	attempts int
+	retryAt  time.Time
+	err      error
+
+	// missingSince is when the path was first found missing, zero while it exists
+	missingSince time.Time
+
+	// parent watches the closest existing parent of a pending path so it is retried as soon as
+	// something is created in it
+	parent    backend
+	parentDir string
+}
+
+// pathStateOf classifies the error returned when adding a path to a watcher
+func pathStateOf(err error) string {
+	switch {
+	case err == nil:
+		return PathActive
+	case os.IsNotExist(err):
+		return PathPending
+	case os.IsPermission(err):
+		return PathPermissionDenied
+	}
+
+	return PathErrored
+}
+
+// setPathState records the outcome of adding the path of a rule, failures are retried with
+// exponential backoff
+func (m *Monitor) setPathState(r *rule, path string, err error) {
+	m.pathsMu.Lock()
+
+	st, ok := m.paths[r]
+	if !ok {
+		st = &pathStatus{}
+		m.paths[r] = st
+	}
+
+	st.path = path
+	st.state = pathStateOf(err)
+	st.err = err
+
+	if st.state != PathPending {
+		st.missingSince = time.Time{}
+	} else if st.missingSince.IsZero() {
+		st.missingSince = time.Now()
+	}
+
+	if err == nil {
+		st.attempts = 0
+		st.retryAt = time.Time{}
+	} else {
+		st.attempts++
+		st.retryAt = time.Now().Add(retry.Backoff(st.attempts, retryBase, retryMax))
+	}
+
+	var closeParent backend
+	var watchParent bool
+	if st.state == PathPending && !r.glob {
+		watchParent = true
+	} else if st.parent != nil {
+		closeParent = st.parent
+		st.parent = nil
+		st.parentDir = ""
+	}
+
+	state := st.state
+	missingSince := st.missingSince
+
+	m.pathsMu.Unlock()
+
+	if closeParent != nil {
+		closeParent.Close()
+	}
+
+	if watchParent {
+		m.watchParent(r, path)
+	}
+
+	for _, s := range PathStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+
+		m.metrics.pathState.WithLabelValues(r.Path.Path, s).Set(value)
+	}
+
+	// the series stays present while the path is missing so it can be alerted on directly
+	if missingSince.IsZero() {
+		m.metrics.fileExists.WithLabelValues(r.Path.Path).Set(1)
+		m.metrics.fileMissingSince.DeleteLabelValues(r.Path.Path)
+	} else {
+		m.metrics.fileExists.WithLabelValues(r.Path.Path).Set(0)
+		m.metrics.fileMissingSince.WithLabelValues(r.Path.Path).Set(toSeconds(missingSince))
+	}
+
+	m.updatePendingMetrics()
+}
+
+// markPending records that a watched path of a rule no longer exists
+func (m *Monitor) markPending(r *rule, path string) {
+	r.forgetPath(path)
+
+	if r.glob {
+		// the glob is only pending once none of its matches are left
+		if len(r.watchedPaths()) > 0 {
+			return
+		}
+
+		path = r.absPath(m.logEntry)
+	}
+
+	m.setPathState(r, path, os.ErrNotExist)
+
+	// the path was there a moment ago, retry it without waiting on the backoff
+	m.pathsMu.Lock()
+	if st, ok := m.paths[r]; ok {
+		st.attempts = 0
+		st.retryAt = time.Now().Add(retryBase)
+	}
+	m.pathsMu.Unlock()
+}
+
+// removePathStatus forgets the path of a rule that is no longer monitored
+func (m *Monitor) removePathStatus(r *rule) {
+	m.pathsMu.Lock()
+	st, ok := m.paths[r]
+	delete(m.paths, r)
+	m.pathsMu.Unlock()
+
+	if ok && st.parent != nil {
+		st.parent.Close()
+	}
+
+	m.metrics.pathState.DeletePartialMatch(prometheus.Labels{"path": r.Path.Path})
+	m.metrics.fileExists.DeleteLabelValues(r.Path.Path)
+	m.metrics.fileMissingSince.DeleteLabelValues(r.Path.Path)
+}
+
+// watchParent watches the closest existing parent directory of a pending path
+func (m *Monitor) watchParent(r *rule, path string) {
+	dir := filepath.Dir(path)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			break
+		}
+
+		next := filepath.Dir(dir)
+		if next == dir {
+			return
+		}
+		dir = next
+	}
+
+	m.pathsMu.Lock()
+	st, ok := m.paths[r]
+	if !ok || st.parentDir == dir {
+		m.pathsMu.Unlock()
+		return
+	}
+
+	previous := st.parent
+
+	parent := newBackend(m.hubs, r.backend)
+	if err := parent.Add(dir); err != nil {
+		m.pathsMu.Unlock()
+		m.logEntry.WithField("path", dir).WithError(err).Debug("unable to watch parent of pending path")
+		return
+	}
+
+	st.parent = parent
+	st.parentDir = dir
+	m.pathsMu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+
+	m.logEntry.WithField("path", path).WithField("parent", dir).Debug("watching parent of pending path")
+
+	go func() {
+		for {
+			select {
+			case <-parent.Events():
+				m.wake(r)
+			case <-parent.Errors():
+			case <-parent.Done():
+				return
+			case <-m.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	m.start(r, parent)
+}
+
+// wake makes the retry of a rule's path due now, the path loop is woken when it is idle and
+// otherwise picks the retry up on its next tick
+func (m *Monitor) wake(r *rule) {
+	m.pathsMu.Lock()
+	if st, ok := m.paths[r]; ok {
+		st.retryAt = time.Now()
+	}
+	m.pathsMu.Unlock()
+
+	select {
+	case m.retry <- r:
+	default:
+	}
+}
+
+// pathLoop retries the paths that could not be watched once their backoff has elapsed, or as soon
+// as their parent directory changes, and periodically refreshes every file
+func (m *Monitor) pathLoop() {
+	defer m.wg.Done()
+
+	m.updatePendingMetrics()
+
+	ticker := time.NewTicker(retryBase)
+	defer ticker.Stop()
+
+	resync := time.NewTicker(resyncInterval)
+	defer resync.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case r := <-m.retry:
+			m.retryPath(r)
+		case <-ticker.C:
+			for _, r := range m.duePaths() {
+				m.retryPath(r)
+			}
+		case <-resync.C:
+			rules := m.snapshot()
+
+			for _, r := range rules {
+				if r.glob {
+					m.expandGlob(r)
+				}
+			}
+
+			m.runWatchedFiles(rules)
+		}
+	}
+}
+
+// duePaths returns the rules whose path is waiting on a retry that is now due
+func (m *Monitor) duePaths() []*rule {
+	m.pathsMu.Lock()
+	defer m.pathsMu.Unlock()
+
+	now := time.Now()
+
+	var due []*rule
+	for r, st := range m.paths {
+		if st.state != PathActive && !now.Before(st.retryAt) {
+			due = append(due, r)
+		}
+	}
+
+	return due
+}
+
+// retryPath tries to watch the path of a rule again
+func (m *Monitor) retryPath(r *rule) {
+	m.pathsMu.Lock()
+	st, ok := m.paths[r]
+	if !ok || st.state == PathActive {
+		m.pathsMu.Unlock()
+		return
+	}
+	path := st.path
+	m.pathsMu.Unlock()
+
+	log := m.logEntry.WithField("path", path).WithField("recursive", r.Recursive)
+	log.Debug("retrying path")
+
+	var err error
+	if r.glob {
+		m.expandGlob(r)
+		if len(r.watchedPaths()) == 0 {
+			err = os.ErrNotExist
+		}
+	} else {
+		err = r.add(path)
+	}
+
+	m.setPathState(r, path, err)
+
+	if err != nil {
+		log.WithError(err).Debug("unable to add path for watching (retrying)")
+		return
+	}
+
+	log.Info("successfully added pending path")
+
+	m.runWatchedFiles([]*rule{r})
+}
+
+func (m *Monitor) updatePendingMetrics() {
+	m.pathsMu.Lock()
+	defer m.pathsMu.Unlock()
+
+	var single, recursive int
+	for r, st := range m.paths {
+		if st.state == PathActive {
+			continue
+		}
+
+		if r.Recursive {
+			recursive++
+		} else {
+			single++
+		}
+	}
+
+	m.metrics.filePendingPaths.Set(float64(single))
+	m.metrics.filePendingRecursivePaths.Set(float64(recursive))
+}
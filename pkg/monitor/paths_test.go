@@ -0,0 +1,257 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+func TestPathStateOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "watched",
+			want: PathActive,
+		},
+		{
+			name: "missing",
+			err:  &fs.PathError{Op: "stat", Path: "/missing", Err: fs.ErrNotExist},
+			want: PathPending,
+		},
+		{
+			name: "permission denied",
+			err:  &fs.PathError{Op: "open", Path: "/root", Err: fs.ErrPermission},
+			want: PathPermissionDenied,
+		},
+		{
+			name: "other error",
+			err:  errors.New("too many open files"),
+			want: PathErrored,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pathStateOf(tt.err); got != tt.want {
+				t.Fatalf("state %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathStateTransitions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "missing", "watched")
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	mon, err := New(Options{
+		Config: &config.Config{
+			Paths: []config.Path{{Path: path}},
+		},
+		Registerer: prometheus.NewRegistry(),
+		Logger:     log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mon.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer mon.Stop()
+
+	steps := []struct {
+		name  string
+		do    func() error
+		state string
+	}{
+		{
+			name:  "missing at startup",
+			state: PathPending,
+		},
+		{
+			name:  "parent created",
+			do:    func() error { return os.Mkdir(filepath.Dir(path), 0o755) },
+			state: PathPending,
+		},
+		{
+			name:  "created",
+			do:    func() error { return os.Mkdir(path, 0o755) },
+			state: PathActive,
+		},
+		{
+			name:  "removed",
+			do:    func() error { return os.Remove(path) },
+			state: PathPending,
+		},
+		{
+			name:  "created again",
+			do:    func() error { return os.Mkdir(path, 0o755) },
+			state: PathActive,
+		},
+	}
+
+	for _, step := range steps {
+		if step.do != nil {
+			if err := step.do(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// a pending path is retried after retryBase at the latest
+		for deadline := time.Now().Add(retryBase + 5*time.Second); pathState(mon, path) != step.state; {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: path is %s, want %s", step.name, pathState(mon, path), step.state)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// pathState returns the state exported for a path, it is empty unless exactly one state is set
+func pathState(m *Monitor, path string) string {
+	state := ""
+	for _, s := range PathStates {
+		switch testutil.ToFloat64(m.metrics.pathState.WithLabelValues(path, s)) {
+		case 1:
+			if state != "" {
+				return ""
+			}
+			state = s
+		case 0:
+		default:
+			return ""
+		}
+	}
+
+	return state
+}
+
+func TestFileExists(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "critical")
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	cfg := &config.Config{
+		Paths: []config.Path{{Path: path}},
+	}
+
+	registry := prometheus.NewRegistry()
+
+	mon, err := New(Options{
+		Config:     cfg,
+		Registerer: registry,
+		Logger:     log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mon.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer mon.Stop()
+
+	// missingSince is the time exported while the path has been missing since a previous step
+	var missingSince float64
+
+	steps := []struct {
+		name   string
+		do     func() error
+		exists float64
+
+		// missing is whether file_missing_since_timestamp_seconds is exported, it must keep the
+		// time the path was first found missing
+		missing bool
+	}{
+		{
+			name:    "missing at startup",
+			exists:  0,
+			missing: true,
+		},
+		{
+			name:    "still missing after a retry",
+			do:      func() error { time.Sleep(retryBase + 100*time.Millisecond); return nil },
+			exists:  0,
+			missing: true,
+		},
+		{
+			name:   "created",
+			do:     func() error { return os.WriteFile(path, []byte("content"), 0o644) },
+			exists: 1,
+		},
+		{
+			name:    "removed",
+			do:      func() error { return os.Remove(path) },
+			exists:  0,
+			missing: true,
+		},
+	}
+
+	for _, step := range steps {
+		if step.do != nil {
+			if err := step.do(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for deadline := time.Now().Add(retryBase + 5*time.Second); ; {
+			exists := testutil.ToFloat64(mon.metrics.fileExists.WithLabelValues(path))
+			missing := slices.Contains(gatherPaths(t, registry, "file_missing_since_timestamp_seconds"), path)
+
+			if exists == step.exists && missing == step.missing {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: file_exists is %v and the missing time is exported %t, want %v and %t", step.name, exists, missing, step.exists, step.missing)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if !step.missing {
+			missingSince = 0
+			continue
+		}
+
+		since := testutil.ToFloat64(mon.metrics.fileMissingSince.WithLabelValues(path))
+		if missingSince != 0 && since != missingSince {
+			t.Fatalf("%s: missing since %v, want %v", step.name, since, missingSince)
+		}
+		missingSince = since
+	}
+
+	// the series of a path that is no longer configured are deleted
+	cfg.Paths = []config.Path{{Path: dir}}
+	if err := mon.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := gatherPaths(t, registry, "file_exists"); !reflect.DeepEqual(got, []string{dir}) {
+		t.Fatalf("file_exists is exported for %v, want only %s", got, dir)
+	}
+
+	if got := gatherPaths(t, registry, "file_missing_since_timestamp_seconds"); len(got) > 0 {
+		t.Fatalf("file_missing_since_timestamp_seconds is exported for %v", got)
+	}
+}
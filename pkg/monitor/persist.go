@@ -0,0 +1,234 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sans-sroc/file_exporter/pkg/atomicfile"
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+// OpOfflineChange is the op of events for files that changed while the monitor was not running
+const OpOfflineChange = "offline_change"
+
+// stateVersion is bumped whenever the layout of the state file changes incompatibly
+const stateVersion = 1
+
+// savedFile is the last known state of a file as written to the state file
+type savedFile struct {
+	Algorithm string      `json:"algorithm"`
+	Policy    string      `json:"policy"`
+	Digest    string      `json:"digest"`
+	CRC32     uint32      `json:"crc32"`
+	Size      int64       `json:"size"`
+	Mode      fs.FileMode `json:"mode"`
+	ModTime   time.Time   `json:"mtime"`
+}
+
+type savedState struct {
+	Version int                  `json:"version"`
+	SavedAt time.Time            `json:"saved_at"`
+	Files   map[string]savedFile `json:"files"`
+}
+
+func newSavedFile(result *hasher.Result, info fs.FileInfo) savedFile {
+	return savedFile{
+		Algorithm: result.Algorithm,
+		Policy:    result.Policy,
+		Digest:    result.Digest,
+		CRC32:     result.CRC32,
+		Size:      info.Size(),
+		Mode:      info.Mode(),
+		ModTime:   info.ModTime(),
+	}
+}
+
+// result returns the saved digest, nil when the file was not hashed
+func (f savedFile) result() *hasher.Result {
+	if f.Algorithm == "" {
+		return nil
+	}
+
+	return &hasher.Result{
+		CRC32:     f.CRC32,
+		Algorithm: f.Algorithm,
+		Digest:    f.Digest,
+		Policy:    f.Policy,
+	}
+}
+
+// differs reports whether the file changed, digests are only compared when they were computed the same way
+func (f savedFile) differs(o savedFile) bool {
+	if f.Size != o.Size || f.Mode != o.Mode || !f.ModTime.Equal(o.ModTime) {
+		return true
+	}
+
+	if f.Algorithm != o.Algorithm || f.Policy != o.Policy {
+		return false
+	}
+
+	return f.CRC32 != o.CRC32 || f.Digest != o.Digest
+}
+
+// loadSavedState reads a state file, a file that does not exist yet is an empty state
+func loadSavedState(path string) (*savedState, error) {
+	state := &savedState{Files: map[string]savedFile{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("unable to parse state file %s: %w", path, err)
+	}
+
+	if state.Version != stateVersion {
+		return nil, fmt.Errorf("state file %s has version %d, expected %d", path, state.Version, stateVersion)
+	}
+
+	if state.Files == nil {
+		state.Files = map[string]savedFile{}
+	}
+
+	return state, nil
+}
+
+// write replaces the state file atomically
+func (s *savedState) write(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(path, data, 0o644)
+}
+
+// checkOffline compares the first digest of a file since startup with the one saved before the
+// monitor last stopped
+func (m *Monitor) checkOffline(metricPath string, result *hasher.Result) {
+	m.offlineMu.Lock()
+	saved, ok := m.offline[metricPath]
+	if ok {
+		delete(m.offline, metricPath)
+	}
+	m.offlineMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	state, ok := m.state.get(metricPath)
+	if !ok || state.info == nil {
+		return
+	}
+
+	if !saved.differs(newSavedFile(result, state.info)) {
+		m.metrics.fileChangedWhileOffline.WithLabelValues(metricPath).Set(0)
+		return
+	}
+
+	m.logEntry.WithField("path", metricPath).Warn("file changed while offline")
+	m.offlineChange(metricPath, saved, result, newFileStat(state.info))
+}
+
+// checkOfflineRemovals reports the saved files that no longer exist once the initial scan is done,
+// files that exist but are no longer monitored are dropped
+func (m *Monitor) checkOfflineRemovals() {
+	m.offlineMu.Lock()
+	removed := map[string]savedFile{}
+	for metricPath, saved := range m.offline {
+		if _, ok := m.state.get(metricPath); ok {
+			continue
+		}
+
+		if _, err := os.Lstat(filepath.Join(m.rootfs, filepath.FromSlash(metricPath))); os.IsNotExist(err) {
+			removed[metricPath] = saved
+		}
+
+		delete(m.offline, metricPath)
+	}
+	m.offlineMu.Unlock()
+
+	for metricPath, saved := range removed {
+		m.logEntry.WithField("path", metricPath).Warn("file removed while offline")
+		m.offlineChange(metricPath, saved, nil, nil)
+	}
+}
+
+func (m *Monitor) offlineChange(metricPath string, saved savedFile, after *hasher.Result, afterStat *FileStat) {
+	m.metrics.fileChangedWhileOffline.WithLabelValues(metricPath).Set(1)
+	m.metrics.fileEvent.WithLabelValues(metricPath, OpOfflineChange).Inc()
+
+	m.publish(Event{
+		Time:   time.Now(),
+		Op:     OpOfflineChange,
+		Path:   metricPath,
+		Before: saved.result(),
+		After:  after,
+
+		// ownership is not saved
+		BeforeStat: &FileStat{
+			Size:    saved.Size,
+			Mode:    saved.Mode.String(),
+			ModTime: saved.ModTime,
+		},
+		AfterStat: afterStat,
+	})
+}
+
+// saveState writes the last known state of every hashed file, files that were saved before but
+// have not been hashed again yet are kept so a restart does not lose them
+func (m *Monitor) saveState() {
+	if m.stateFile == "" {
+		return
+	}
+
+	saved := &savedState{
+		Version: stateVersion,
+		SavedAt: time.Now().UTC(),
+		Files:   map[string]savedFile{},
+	}
+
+	m.offlineMu.Lock()
+	for metricPath, f := range m.offline {
+		saved.Files[metricPath] = f
+	}
+	m.offlineMu.Unlock()
+
+	for _, state := range m.state.snapshot() {
+		if state.digest == nil || state.info == nil {
+			continue
+		}
+
+		saved.Files[state.metricPath] = newSavedFile(state.digest, state.info)
+	}
+
+	if err := saved.write(m.stateFile); err != nil {
+		m.logEntry.WithField("path", m.stateFile).WithError(err).Error("unable to save state")
+	}
+}
+
+// persistLoop saves the state periodically until the monitor stops
+func (m *Monitor) persistLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.saveState()
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+func TestSavedFileDiffers(t *testing.T) {
+	now := time.Now()
+	saved := savedFile{Algorithm: "sha256", Policy: "full", Digest: "a", CRC32: 1, Size: 1, Mode: 0o644, ModTime: now}
+
+	tests := []struct {
+		name    string
+		modify  func(f *savedFile)
+		differs bool
+	}{
+		{
+			name:   "unchanged",
+			modify: func(f *savedFile) {},
+		},
+		{
+			name:    "size",
+			modify:  func(f *savedFile) { f.Size = 2 },
+			differs: true,
+		},
+		{
+			name:    "mode",
+			modify:  func(f *savedFile) { f.Mode = 0o600 },
+			differs: true,
+		},
+		{
+			name:    "modification time",
+			modify:  func(f *savedFile) { f.ModTime = now.Add(time.Second) },
+			differs: true,
+		},
+		{
+			name:    "digest",
+			modify:  func(f *savedFile) { f.Digest = "b" },
+			differs: true,
+		},
+		{
+			name:    "crc32",
+			modify:  func(f *savedFile) { f.CRC32 = 2 },
+			differs: true,
+		},
+		{
+			name:   "other algorithm",
+			modify: func(f *savedFile) { f.Algorithm, f.Digest = "md5", "b" },
+		},
+		{
+			name:   "other policy",
+			modify: func(f *savedFile) { f.Policy, f.Digest = "sample", "b" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := saved
+			tt.modify(&current)
+
+			if got := saved.differs(current); got != tt.differs {
+				t.Fatalf("differs is %t, want %t", got, tt.differs)
+			}
+		})
+	}
+}
+
+func TestLoadSavedState(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name  string
+		data  string
+		files int
+		err   bool
+	}{
+		{
+			name: "missing",
+		},
+		{
+			name:  "saved",
+			data:  `{"version": 1, "files": {"/a": {"size": 1}}}`,
+			files: 1,
+		},
+		{
+			name: "no files",
+			data: `{"version": 1}`,
+		},
+		{
+			name: "other version",
+			data: `{"version": 2, "files": {}}`,
+			err:  true,
+		},
+		{
+			name: "invalid",
+			data: `{`,
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if tt.data != "" {
+				if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			state, err := loadSavedState(path)
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, want an error %t", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if state.Files == nil || len(state.Files) != tt.files {
+				t.Fatalf("loaded %v, want %d files", state.Files, tt.files)
+			}
+		})
+	}
+}
+
+func TestOfflineChanges(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	files := []struct {
+		name    string
+		offline func(path string) error
+		changed bool
+	}{
+		{
+			name: "unchanged",
+		},
+		{
+			name:    "written",
+			offline: func(path string) error { return os.WriteFile(path, []byte("other content"), 0o644) },
+			changed: true,
+		},
+		{
+			name:    "chmod",
+			offline: func(path string) error { return os.Chmod(path, 0o600) },
+			changed: true,
+		},
+		{
+			name:    "removed",
+			offline: os.Remove,
+			changed: true,
+		},
+	}
+
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.name), []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first run only saves the state once every file has been hashed
+	first := newOfflineMonitor(t, dir, stateFile)
+	for _, f := range files {
+		waitForSeries(t, first.registry, "file_content_hash_crc32", filepath.Join(dir, f.name))
+	}
+	first.Stop()
+
+	var want []string
+	for _, f := range files {
+		if f.offline != nil {
+			if err := f.offline(filepath.Join(dir, f.name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if f.changed {
+			want = append(want, filepath.ToSlash(filepath.Join(dir, f.name)))
+		}
+	}
+	sort.Strings(want)
+
+	second := newOfflineMonitor(t, dir, stateFile)
+	defer second.Stop()
+
+	for _, f := range files {
+		metricPath := filepath.ToSlash(filepath.Join(dir, f.name))
+		waitForSeries(t, second.registry, "file_changed_while_offline", metricPath)
+
+		wantValue := 0.0
+		if f.changed {
+			wantValue = 1
+		}
+
+		if got := testutil.ToFloat64(second.metrics.fileChangedWhileOffline.WithLabelValues(metricPath)); got != wantValue {
+			t.Errorf("%s: file_changed_while_offline is %v, want %v", f.name, got, wantValue)
+		}
+	}
+
+	var got []string
+	for len(got) < len(want) {
+		select {
+		case event := <-second.events:
+			if event.Op == OpOfflineChange {
+				got = append(got, event.Path)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("offline changes %v, want %v", got, want)
+		}
+	}
+	sort.Strings(got)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("offline changes %v, want %v", got, want)
+	}
+}
+
+type offlineMonitor struct {
+	*Monitor
+	registry *prometheus.Registry
+	events   <-chan Event
+}
+
+func newOfflineMonitor(t *testing.T, dir string, stateFile string) *offlineMonitor {
+	t.Helper()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	registry := prometheus.NewRegistry()
+
+	mon, err := New(Options{
+		Config: &config.Config{
+			Paths:     []config.Path{{Path: dir}},
+			StateFile: stateFile,
+		},
+		Registerer: registry,
+		Logger:     log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := mon.Subscribe("test", 16)
+
+	if err := mon.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return &offlineMonitor{Monitor: mon, registry: registry, events: events}
+}
+
+// waitForSeries waits until the metric has been exported for a path
+func waitForSeries(t *testing.T, g prometheus.Gatherer, name string, path string) {
+	t.Helper()
+
+	metricPath := filepath.ToSlash(path)
+
+	for deadline := time.Now().Add(5 * time.Second); !slices.Contains(gatherPaths(t, g, name), metricPath); {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not exported for %s", name, metricPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
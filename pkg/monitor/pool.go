@@ -0,0 +1,351 @@
+package monitor
+
+import (
+	"container/heap"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+// chunkSize is the largest read made against the I/O budget at once
+const chunkSize = 32 * 1024
+
+type hashJob struct {
+	rule       *rule
+	path       string
+	metricPath string
+	info       os.FileInfo
+	policy     hasher.Policy
+	result     *hasher.Result
+	seq        uint64
+	index      int
+
+	// cancelled is set when the file is removed while it is being hashed
+	cancelled bool
+
+	// resubmit holds a newer job for the same path that arrived while this one was running
+	resubmit *hashJob
+}
+
+// jobQueue orders jobs by rule priority, then smallest file first, then submission order
+type jobQueue []*hashJob
+
+func (q jobQueue) Len() int {
+	return len(q)
+}
+
+func (q jobQueue) Less(i, j int) bool {
+	if q[i].rule.Priority != q[j].rule.Priority {
+		return q[i].rule.Priority > q[j].rule.Priority
+	}
+
+	if q[i].info.Size() != q[j].info.Size() {
+		return q[i].info.Size() < q[j].info.Size()
+	}
+
+	return q[i].seq < q[j].seq
+}
+
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x interface{}) {
+	job := x.(*hashJob)
+	job.index = len(*q)
+	*q = append(*q, job)
+}
+
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return job
+}
+
+// pool hashes files on a bounded number of workers sharing an I/O budget,
+// at most one job per path is queued or running at any time
+type pool struct {
+	metrics  *metrics
+	hashes   *hashCache
+	logEntry *logrus.Entry
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	ctx     context.Context
+	queue   jobQueue
+	queued  map[string]*hashJob
+	active  map[string]*hashJob
+	seq     uint64
+	workers int
+	running int
+	closed  bool
+	limiter *rate.Limiter
+	results chan *hashJob
+}
+
+func newPool(m *metrics, hashes *hashCache, logEntry *logrus.Entry) *pool {
+	p := &pool{
+		metrics:  m,
+		hashes:   hashes,
+		logEntry: logEntry.WithField("component", "hash"),
+		results:  make(chan *hashJob, 64),
+		ctx:      context.Background(),
+		queued:   map[string]*hashJob{},
+		active:   map[string]*hashJob{},
+		limiter:  rate.NewLimiter(rate.Inf, chunkSize),
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	return p
+}
+
+// start sets the context that bounds hashing, waiting on the I/O budget ends when it is done
+func (p *pool) start(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ctx = ctx
+}
+
+// stop makes every worker exit once its current job is done
+func (p *pool) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.cond.Broadcast()
+}
+
+// configure sets the number of workers and the I/O budget in bytes per second, 0 is unlimited
+func (p *pool) configure(workers int, bytesPerSecond int64) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if bytesPerSecond > 0 {
+		p.limiter.SetLimit(rate.Limit(bytesPerSecond))
+	} else {
+		p.limiter.SetLimit(rate.Inf)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.workers = workers
+	for p.running < p.workers {
+		p.running++
+		go p.work()
+	}
+
+	// surplus workers exit once they wake up
+	p.cond.Broadcast()
+}
+
+func (p *pool) submit(r *rule, path string, metricPath string, info os.FileInfo, policy hasher.Policy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	job := &hashJob{
+		rule:       r,
+		path:       path,
+		metricPath: metricPath,
+		info:       info,
+		policy:     policy,
+	}
+
+	if active, ok := p.active[path]; ok {
+		active.resubmit = job
+		return
+	}
+
+	if queued, ok := p.queued[path]; ok {
+		queued.rule = r
+		queued.metricPath = metricPath
+		queued.info = info
+		queued.policy = policy
+		heap.Fix(&p.queue, queued.index)
+		return
+	}
+
+	p.push(job)
+}
+
+// push queues a job, p.mu must be held
+func (p *pool) push(job *hashJob) {
+	p.seq++
+	job.seq = p.seq
+
+	heap.Push(&p.queue, job)
+	p.queued[job.path] = job
+
+	p.metrics.hashQueueDepth.Set(float64(len(p.queue)))
+	p.cond.Signal()
+}
+
+// cancel drops any queued job for the path and discards the result of a running one
+func (p *pool) cancel(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if queued, ok := p.queued[path]; ok {
+		heap.Remove(&p.queue, queued.index)
+		delete(p.queued, path)
+		p.metrics.hashQueueDepth.Set(float64(len(p.queue)))
+	}
+
+	if active, ok := p.active[path]; ok {
+		active.cancelled = true
+		active.resubmit = nil
+	}
+}
+
+func (p *pool) work() {
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && p.running <= p.workers && !p.closed {
+			p.cond.Wait()
+		}
+
+		if p.closed || p.running > p.workers {
+			p.running--
+			p.mu.Unlock()
+			return
+		}
+
+		job := heap.Pop(&p.queue).(*hashJob)
+		delete(p.queued, job.path)
+		p.active[job.path] = job
+		p.metrics.hashQueueDepth.Set(float64(len(p.queue)))
+		ctx := p.ctx
+		p.mu.Unlock()
+
+		p.run(ctx, job)
+
+		p.mu.Lock()
+		delete(p.active, job.path)
+		if job.resubmit != nil {
+			p.push(job.resubmit)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// busy reports whether a file is queued or being hashed
+func (p *pool) busy(path string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, queued := p.queued[path]
+	_, active := p.active[path]
+
+	return queued || active
+}
+
+func (p *pool) run(ctx context.Context, job *hashJob) {
+	logEntry := p.logEntry.WithField("path", job.metricPath)
+
+	start := time.Now()
+
+	result, err := p.hash(ctx, job.path, job.rule.Hash, job.policy)
+
+	p.metrics.hashDuration.WithLabelValues(job.rule.Hash).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		logEntry.WithError(err).Error("unable to hash file")
+	}
+
+	// a failed job is still applied, without a result, so the events waiting on it are published
+	job.result = result
+
+	// results are applied by the event loop so changes are seen in the order they happened
+	select {
+	case p.results <- job:
+	case <-ctx.Done():
+	}
+}
+
+// apply caches the result of a job and calls fn with it unless the file was removed in the
+// meantime, and reports whether it did. fn runs with p.mu held so it must not block, the events of
+// the job are published by the caller once it returns.
+func (p *pool) apply(job *hashJob, fn func(job *hashJob)) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// checked under p.mu so a removal cannot slip in between and leave the result cached
+	if job.cancelled {
+		return false
+	}
+
+	if job.result != nil {
+		p.hashes.store(job.path, job.info, job.policy, job.result)
+	}
+
+	fn(job)
+
+	return true
+}
+
+func (p *pool) hash(ctx context.Context, path string, algorithm string, policy hasher.Policy) (*hasher.Result, error) {
+	p.metrics.hashCacheMisses.Inc()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if policy.Name != hasher.PolicyFull {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		r = policy.Reader(file, info.Size())
+	}
+
+	result, err := hasher.Reader(&throttledReader{ctx: ctx, r: r, limiter: p.limiter}, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Policy = policy.String()
+
+	p.metrics.hashedBytes.Add(float64(result.Size))
+
+	return result, nil
+}
+
+// throttledReader waits on the shared I/O budget for every chunk it reads
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(b []byte) (int, error) {
+	if len(b) > chunkSize {
+		b = b[:chunkSize]
+	}
+
+	n, err := t.r.Read(b)
+	if n > 0 {
+		if werr := t.limiter.WaitN(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
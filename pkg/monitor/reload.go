@@ -0,0 +1,201 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+// Errors returned by AddPath and RemovePath
+var (
+	ErrPathMonitored    = errors.New("path is already monitored")
+	ErrPathNotMonitored = errors.New("path is not monitored")
+)
+
+// Reload applies a new configuration to the monitor. Rules that are unchanged keep their watcher
+// (and therefore their counters), new rules are started and removed rules are stopped with the
+// series of any file that is no longer monitored deleted.
+func (m *Monitor) Reload(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+
+	existing := map[string][]*rule{}
+	for _, r := range m.rules {
+		key := ruleKey(r.Path, r.rootfs, r.backend)
+		existing[key] = append(existing[key], r)
+	}
+
+	var rules, added []*rule
+	for _, p := range cfg.Paths {
+		p.ApplyDefaults(config.Path{})
+
+		key := ruleKey(p, cfg.RootFS, cfg.Backend)
+
+		if matches := existing[key]; len(matches) > 0 {
+			r := matches[0]
+			existing[key] = matches[1:]
+
+			r.setLabels(p.Labels)
+			rules = append(rules, r)
+			continue
+		}
+
+		r, err := newRule(p, cfg.RootFS, cfg.Backend, m.hubs)
+		if err != nil {
+			m.mu.Unlock()
+			return err
+		}
+
+		rules = append(rules, r)
+		added = append(added, r)
+	}
+
+	var removed []*rule
+	for _, matches := range existing {
+		removed = append(removed, matches...)
+	}
+
+	m.rules = rules
+	m.configure(cfg)
+
+	m.mu.Unlock()
+
+	m.logEntry.WithField("added", len(added)).WithField("removed", len(removed)).Info("reloading configuration")
+
+	if m.running() {
+		m.startRules(added)
+	}
+
+	for _, r := range rules {
+		for path, f := range r.watcher.WatchedFiles() {
+			if f.IsDir() {
+				continue
+			}
+
+			m.metrics.fileLabels.set(toMetricPath(path, r.rootfs), r.getLabels())
+		}
+	}
+
+	m.stopRules(removed)
+
+	return nil
+}
+
+// AddPath starts monitoring a path that is not part of the configuration, settings that are
+// left empty use the defaults. It is lost on the next reload unless added to the configuration.
+func (m *Monitor) AddPath(p config.Path) error {
+	p.ApplyDefaults(config.Path{})
+
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+
+	for _, r := range m.rules {
+		if r.Path.Path == p.Path {
+			m.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrPathMonitored, p.Path)
+		}
+	}
+
+	r, err := newRule(p, m.rootfs, m.backend, m.hubs)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	m.rules = append(m.rules, r)
+
+	m.mu.Unlock()
+
+	m.logEntry.WithField("path", p.Path).Info("adding path")
+
+	if m.running() {
+		m.startRules([]*rule{r})
+	}
+
+	m.updatePendingMetrics()
+
+	return nil
+}
+
+// RemovePath stops monitoring a path and deletes the series of its files
+func (m *Monitor) RemovePath(path string) error {
+	m.mu.Lock()
+
+	var rules, removed []*rule
+	for _, r := range m.rules {
+		if r.Path.Path == path {
+			removed = append(removed, r)
+		} else {
+			rules = append(rules, r)
+		}
+	}
+
+	m.rules = rules
+
+	m.mu.Unlock()
+
+	if len(removed) == 0 {
+		return fmt.Errorf("%w: %s", ErrPathNotMonitored, path)
+	}
+
+	m.logEntry.WithField("path", path).Info("removing path")
+
+	m.stopRules(removed)
+
+	return nil
+}
+
+// stopRules closes the watchers of rules that were removed and deletes the series of any
+// file that is not covered by one of the remaining rules
+func (m *Monitor) stopRules(removed []*rule) {
+	still := map[string]bool{}
+	for _, r := range m.snapshot() {
+		for path, f := range r.watcher.WatchedFiles() {
+			if !f.IsDir() {
+				still[toMetricPath(path, r.rootfs)] = true
+			}
+		}
+	}
+
+	for _, r := range removed {
+		files := r.watcher.WatchedFiles()
+
+		r.watcher.Close()
+		m.removePathStatus(r)
+
+		for path, f := range files {
+			if f.IsDir() {
+				continue
+			}
+
+			metricPath := toMetricPath(path, r.rootfs)
+			if still[metricPath] {
+				continue
+			}
+
+			m.logEntry.WithField("path", metricPath).Debug("path no longer monitored")
+
+			m.pool.cancel(path)
+			m.deleteMetrics(metricPath)
+			m.hashes.forget(path)
+			m.metrics.fileEvent.DeletePartialMatch(prometheus.Labels{"path": metricPath})
+			m.metrics.fileContentChanges.DeleteLabelValues(metricPath)
+		}
+	}
+
+	m.updatePendingMetrics()
+}
+
+// ruleKey identifies the settings of a rule that require a new watcher when they change
+func ruleKey(p config.Path, rootfs string, backend string) string {
+	return fmt.Sprintf("%s|%s|%s|%t|%s|%t|%s|%s|%d|%+v", rootfs, backend, p.Path, p.Recursive, p.Regex, p.RegexFullPath, p.Hash, p.Interval, p.Priority, p.LargeFile)
+}
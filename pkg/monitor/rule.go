@@ -0,0 +1,198 @@
+package monitor
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+// rule is a configured path along with the watcher that polls it
+type rule struct {
+	config.Path
+
+	watcher backend
+	backend string
+	rootfs  string
+	glob    bool
+
+	// mu protects paths, the absolute paths that have been added to the watcher, labels and the
+	// activity of the tracked files reported by the rule
+	mu        sync.Mutex
+	paths     map[string]bool
+	labels    map[string]string
+	files     int
+	lastEvent time.Time
+	lastOp    string
+}
+
+type ruleEvent struct {
+	rule  *rule
+	event watcher.Event
+}
+
+type ruleError struct {
+	rule *rule
+	err  error
+}
+
+func newRule(p config.Path, rootfs string, backendName string, hubs *notifyHubs) (*rule, error) {
+	var filters []watcher.FilterFileHookFunc
+	if p.Regex != "" {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, watcher.RegexFilterHook(re, p.RegexFullPath))
+	}
+
+	return &rule{
+		Path:    p,
+		watcher: newBackend(hubs, backendName, filters...),
+		backend: backendName,
+		rootfs:  rootfs,
+		glob:    hasGlobMeta(p.Path),
+		paths:   map[string]bool{},
+		labels:  p.Labels,
+	}, nil
+}
+
+// forward funnels the events and errors of the rule's watcher into the shared event loop
+func (r *rule) forward(ctx context.Context, events chan<- ruleEvent, errs chan<- ruleError) {
+	for {
+		select {
+		case event := <-r.watcher.Events():
+			select {
+			case events <- ruleEvent{rule: r, event: event}:
+			case <-ctx.Done():
+				return
+			}
+		case err := <-r.watcher.Errors():
+			select {
+			case errs <- ruleError{rule: r, err: err}:
+			case <-ctx.Done():
+				return
+			}
+		case <-r.watcher.Done():
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// absPath joins the path with the rootfs and makes it absolute
+func (r *rule) absPath(logEntry *logrus.Entry) string {
+	path := filepath.Join(r.rootfs, r.Path.Path)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		logEntry.WithError(err).Error("unable to get abs path")
+		return path
+	}
+
+	return abs
+}
+
+func (r *rule) add(path string) error {
+	var err error
+	if r.Recursive {
+		err = r.watcher.AddRecursive(path)
+	} else {
+		err = r.watcher.Add(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.paths[path] = true
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *rule) forgetPath(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.paths, path)
+}
+
+func (r *rule) watchedPaths() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paths := make([]string, 0, len(r.paths))
+	for path := range r.paths {
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+// trackFiles adds delta to the number of tracked files reported by the rule
+func (r *rule) trackFiles(delta int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.files += delta
+}
+
+// recordEvent keeps the most recent event on the files of the rule
+func (r *rule) recordEvent(op string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if at.After(r.lastEvent) {
+		r.lastEvent = at
+		r.lastOp = op
+	}
+}
+
+// activity returns the number of tracked files reported by the rule and the last event on them
+func (r *rule) activity() (int, time.Time, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.files, r.lastEvent, r.lastOp
+}
+
+func (r *rule) getLabels() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.labels
+}
+
+func (r *rule) setLabels(labels map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.labels = labels
+}
+
+// policy returns how a file of the given size is hashed
+func (r *rule) policy(size int64) hasher.Policy {
+	if r.LargeFile.Threshold == 0 || size <= r.LargeFile.Threshold {
+		return hasher.Policy{Name: hasher.PolicyFull}
+	}
+
+	return hasher.Policy{
+		Name:   r.LargeFile.Policy,
+		Bytes:  r.LargeFile.Bytes,
+		Blocks: r.LargeFile.Blocks,
+	}
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
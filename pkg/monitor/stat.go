@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+// fileDetails holds the platform specific fields of a stat
+type fileDetails struct {
+	uid   uint64
+	gid   uint64
+	inode uint64
+	links uint64
+
+	// blocks is the allocated size in bytes
+	blocks int64
+}
+
+// setStatMetrics enables the given stat metrics, the series of any metric that is disabled are removed
+func (m *Monitor) setStatMetrics(names []string) {
+	enabled := map[string]bool{}
+	for _, name := range names {
+		enabled[name] = true
+	}
+
+	previous, _ := m.enabledStats.Load().(map[string]bool)
+	for name := range previous {
+		if !enabled[name] {
+			m.metrics.statVec(name).Reset()
+		}
+	}
+
+	m.enabledStats.Store(enabled)
+}
+
+func (m *Monitor) generateStatMetrics(metricPath string, path string, info os.FileInfo) {
+	enabled, _ := m.enabledStats.Load().(map[string]bool)
+	if len(enabled) == 0 {
+		return
+	}
+
+	if enabled[config.StatSize] {
+		m.metrics.fileSize.WithLabelValues(metricPath).Set(float64(info.Size()))
+	}
+
+	if details, ok := statDetails(info); ok {
+		if enabled[config.StatUID] {
+			m.metrics.fileOwnerUID.WithLabelValues(metricPath).Set(float64(details.uid))
+		}
+		if enabled[config.StatGID] {
+			m.metrics.fileOwnerGID.WithLabelValues(metricPath).Set(float64(details.gid))
+		}
+		if enabled[config.StatInode] {
+			m.metrics.fileInode.WithLabelValues(metricPath).Set(float64(details.inode))
+		}
+		if enabled[config.StatLinks] {
+			m.metrics.fileHardLinks.WithLabelValues(metricPath).Set(float64(details.links))
+		}
+		if enabled[config.StatBlocks] {
+			m.metrics.fileAllocatedBlocks.WithLabelValues(metricPath).Set(float64(details.blocks))
+		}
+	}
+
+	if enabled[config.StatType] {
+		// the other metrics follow symlinks, the type reports the link itself
+		if linfo, err := os.Lstat(path); err == nil {
+			m.metrics.fileType.DeletePartialMatch(prometheus.Labels{"path": metricPath})
+			m.metrics.fileType.WithLabelValues(metricPath, fileTypeName(linfo.Mode())).Set(1)
+		}
+	}
+}
+
+func fileTypeName(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "regular"
+	case mode&os.ModeDir != 0:
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "char_device"
+	case mode&os.ModeDevice != 0:
+		return "block_device"
+	}
+
+	return "other"
+}
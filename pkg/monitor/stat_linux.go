@@ -0,0 +1,17 @@
+package monitor
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// statTimes returns the change and access time of a file
+func statTimes(info os.FileInfo) (ctime time.Time, atime time.Time, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ctime, atime, false
+	}
+
+	return time.Unix(st.Ctim.Unix()), time.Unix(st.Atim.Unix()), true
+}
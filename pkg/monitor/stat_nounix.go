@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+
+package monitor
+
+import (
+	"os"
+)
+
+// statDetails is only implemented on Linux and macOS
+func statDetails(info os.FileInfo) (fileDetails, bool) {
+	return fileDetails{}, false
+}
+
+// fileID is only implemented on Linux and macOS, files are identified by path instead
+func fileID(info os.FileInfo) (dev uint64, inode uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package monitor
+
+import (
+	"os"
+	"time"
+)
+
+// statTimes is only implemented on Linux
+func statTimes(info os.FileInfo) (ctime time.Time, atime time.Time, ok bool) {
+	return ctime, atime, false
+}
@@ -0,0 +1,34 @@
+//go:build linux || darwin
+
+package monitor
+
+import (
+	"os"
+	"syscall"
+)
+
+// statDetails returns the ownership, inode and allocation of a file
+func statDetails(info os.FileInfo) (fileDetails, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileDetails{}, false
+	}
+
+	return fileDetails{
+		uid:    uint64(st.Uid),
+		gid:    uint64(st.Gid),
+		inode:  uint64(st.Ino),
+		links:  uint64(st.Nlink),
+		blocks: int64(st.Blocks) * 512,
+	}, true
+}
+
+// fileID returns the device and inode of a file
+func fileID(info os.FileInfo) (dev uint64, inode uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return uint64(st.Dev), uint64(st.Ino), true
+}
@@ -0,0 +1,230 @@
+package monitor
+
+import (
+	"container/list"
+	"io/fs"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+// fileState is what is known about a monitored file between events
+type fileState struct {
+	metricPath string
+
+	// path is the location of the file on disk, including the rootfs
+	path string
+	info fs.FileInfo
+
+	// digest is the last hash exported for the file
+	digest *hasher.Result
+
+	lastEvent time.Time
+	lastOp    string
+
+	// rules are the rules that reported the file, they count it among their files
+	rules []*rule
+}
+
+// track counts the file among the files of a rule the first time the rule reports it
+func (state *fileState) track(r *rule) {
+	if slices.Contains(state.rules, r) {
+		return
+	}
+
+	state.rules = append(state.rules, r)
+	r.trackFiles(1)
+}
+
+// untrack removes the file from the count of every rule that reported it
+func (state *fileState) untrack() {
+	for _, r := range state.rules {
+		r.trackFiles(-1)
+	}
+}
+
+// stateStore holds the state of every monitored file keyed by metric path. When a limit is set
+// the least recently updated files are evicted first.
+//
+// An evicted file keeps its last digest in digests, a fraction of the size of its state, until it
+// is seen again or removed. Its change is then still compared to the digest from before the
+// eviction, but it is hashed again and it evicts another file in turn: a limit below the number of
+// files present trades memory for hashing the files beyond it on every resync.
+type stateStore struct {
+	tracked prometheus.Gauge
+
+	// evicted is called with every entry dropped to stay within the limit
+	evicted func(state *fileState)
+
+	mu      sync.Mutex
+	limit   int
+	order   *list.List
+	entries map[string]*list.Element
+	digests map[string]*hasher.Result
+}
+
+func newStateStore(tracked prometheus.Gauge, evicted func(state *fileState)) *stateStore {
+	return &stateStore{
+		tracked: tracked,
+		evicted: evicted,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		digests: map[string]*hasher.Result{},
+	}
+}
+
+// setLimit bounds the number of files tracked, 0 is unlimited
+func (s *stateStore) setLimit(limit int) {
+	s.mu.Lock()
+	s.limit = limit
+	evicted := s.evict()
+	s.mu.Unlock()
+
+	s.notify(evicted)
+}
+
+// update applies fn to the state of a file, creating it when missing, and marks it most recently used
+func (s *stateStore) update(metricPath string, fn func(state *fileState)) {
+	s.mu.Lock()
+
+	el, ok := s.entries[metricPath]
+	if ok {
+		s.order.MoveToFront(el)
+	} else {
+		el = s.order.PushFront(&fileState{metricPath: metricPath, digest: s.digests[metricPath]})
+		s.entries[metricPath] = el
+		delete(s.digests, metricPath)
+	}
+
+	fn(el.Value.(*fileState))
+
+	evicted := s.evict()
+	s.tracked.Set(float64(len(s.entries)))
+	s.mu.Unlock()
+
+	s.notify(evicted)
+}
+
+// get returns a copy of the state of a file
+func (s *stateStore) get(metricPath string) (fileState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[metricPath]
+	if !ok {
+		return fileState{}, false
+	}
+
+	return *el.Value.(*fileState), true
+}
+
+func (s *stateStore) delete(metricPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[metricPath]; ok {
+		s.order.Remove(el).(*fileState).untrack()
+		delete(s.entries, metricPath)
+	}
+
+	delete(s.digests, metricPath)
+
+	s.tracked.Set(float64(len(s.entries)))
+}
+
+// setInfo records the latest stat of a file reported by a rule
+func (s *stateStore) setInfo(metricPath string, path string, info fs.FileInfo, r *rule) {
+	s.update(metricPath, func(state *fileState) {
+		state.path = path
+		state.info = info
+		state.track(r)
+	})
+}
+
+// recordEvent records the last operation seen for a file, on the file and on the rules covering it
+func (s *stateStore) recordEvent(metricPath string, op string, at time.Time) {
+	s.update(metricPath, func(state *fileState) {
+		state.lastOp = op
+		state.lastEvent = at
+
+		for _, r := range state.rules {
+			r.recordEvent(op, at)
+		}
+	})
+}
+
+// observe records the digest of a file and reports whether it differs from the previous one, the
+// first digest and a digest computed with a different algorithm or policy are not changes
+func (s *stateStore) observe(metricPath string, result *hasher.Result) bool {
+	var changed bool
+
+	s.update(metricPath, func(state *fileState) {
+		previous := state.digest
+		state.digest = result
+
+		if previous == nil || previous.Algorithm != result.Algorithm || previous.Policy != result.Policy {
+			return
+		}
+
+		changed = previous.CRC32 != result.CRC32 || previous.Digest != result.Digest
+	})
+
+	return changed
+}
+
+// setDigest records the digest of a file without comparing it to the previous one
+func (s *stateStore) setDigest(metricPath string, result *hasher.Result) {
+	s.update(metricPath, func(state *fileState) {
+		state.digest = result
+	})
+}
+
+// snapshot returns a copy of the state of every file
+func (s *stateStore) snapshot() []fileState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]fileState, 0, len(s.entries))
+	for el := s.order.Front(); el != nil; el = el.Next() {
+		states = append(states, *el.Value.(*fileState))
+	}
+
+	return states
+}
+
+// evict drops the least recently used entries above the limit, s.mu must be held
+func (s *stateStore) evict() []*fileState {
+	if s.limit <= 0 {
+		return nil
+	}
+
+	var evicted []*fileState
+	for len(s.entries) > s.limit {
+		el := s.order.Back()
+		state := s.order.Remove(el).(*fileState)
+		delete(s.entries, state.metricPath)
+		state.untrack()
+
+		if state.digest != nil {
+			s.digests[state.metricPath] = state.digest
+		}
+
+		evicted = append(evicted, state)
+	}
+
+	return evicted
+}
+
+func (s *stateStore) notify(evicted []*fileState) {
+	if s.evicted == nil {
+		return
+	}
+
+	for _, state := range evicted {
+		s.evicted(state)
+	}
+}
@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+)
+
+func TestStateStoreEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		updates []string
+		evicted []string
+		want    []string
+	}{
+		{
+			name:    "unlimited",
+			updates: []string{"a", "b", "c"},
+			want:    []string{"c", "b", "a"},
+		},
+		{
+			name:    "least recently updated first",
+			limit:   2,
+			updates: []string{"a", "b", "c"},
+			evicted: []string{"a"},
+			want:    []string{"c", "b"},
+		},
+		{
+			name:    "update moves to the front",
+			limit:   2,
+			updates: []string{"a", "b", "a", "c"},
+			evicted: []string{"b"},
+			want:    []string{"c", "a"},
+		},
+		{
+			name:    "single entry",
+			limit:   1,
+			updates: []string{"a", "b", "c"},
+			evicted: []string{"a", "b"},
+			want:    []string{"c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracked := prometheus.NewGauge(prometheus.GaugeOpts{Name: "tracked"})
+
+			var evicted []string
+			s := newStateStore(tracked, func(state *fileState) {
+				evicted = append(evicted, state.metricPath)
+			})
+			s.setLimit(tt.limit)
+
+			r := &rule{}
+			for _, metricPath := range tt.updates {
+				s.setInfo(metricPath, metricPath, nil, r)
+			}
+
+			if !reflect.DeepEqual(evicted, tt.evicted) {
+				t.Fatalf("evicted %v, want %v", evicted, tt.evicted)
+			}
+
+			if got := metricPaths(s.snapshot()); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("tracked %v, want %v", got, tt.want)
+			}
+
+			if got := testutil.ToFloat64(tracked); got != float64(len(tt.want)) {
+				t.Fatalf("tracked gauge is %v, want %d", got, len(tt.want))
+			}
+
+			if files, _, _ := r.activity(); files != len(tt.want) {
+				t.Fatalf("rule counts %d files, want %d", files, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestStateStoreSetLimit(t *testing.T) {
+	tracked := prometheus.NewGauge(prometheus.GaugeOpts{Name: "tracked"})
+
+	var evicted []string
+	s := newStateStore(tracked, func(state *fileState) {
+		evicted = append(evicted, state.metricPath)
+	})
+
+	r := &rule{}
+	for _, metricPath := range []string{"a", "b", "c", "d"} {
+		s.setInfo(metricPath, metricPath, nil, r)
+	}
+
+	s.recordEvent("a", "WRITE", time.Now())
+
+	// lowering the limit evicts right away, the entries that were not updated since go first
+	s.setLimit(2)
+
+	if want := []string{"b", "c"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("evicted %v, want %v", evicted, want)
+	}
+
+	if files, _, op := r.activity(); files != 2 || op != "WRITE" {
+		t.Fatalf("rule counts %d files with last op %q, want 2 and WRITE", files, op)
+	}
+
+	s.delete("a")
+
+	if files, _, _ := r.activity(); files != 1 {
+		t.Fatalf("rule counts %d files after a delete, want 1", files)
+	}
+
+	if got := testutil.ToFloat64(tracked); got != 1 {
+		t.Fatalf("tracked gauge is %v, want 1", got)
+	}
+
+	// a file reported twice by the same rule is counted once
+	s.setInfo("d", "d", nil, r)
+
+	if files, _, _ := r.activity(); files != 1 {
+		t.Fatalf("rule counts %d files, want 1", files)
+	}
+}
+
+func metricPaths(states []fileState) []string {
+	paths := make([]string, 0, len(states))
+	for _, state := range states {
+		paths = append(paths, state.metricPath)
+	}
+
+	return paths
+}
+
+func TestStateStoreEvictedDigest(t *testing.T) {
+	s := newStateStore(prometheus.NewGauge(prometheus.GaugeOpts{Name: "tracked"}), nil)
+	s.setLimit(1)
+
+	r := &rule{}
+	digest := func(d string) *hasher.Result {
+		return &hasher.Result{Algorithm: hasher.SHA256, Digest: d, Policy: hasher.PolicyFull}
+	}
+
+	// evict replaces a with b, only the digest of a is kept
+	evict := func(t *testing.T) {
+		s.setInfo("b", "b", nil, r)
+
+		if _, ok := s.get("a"); ok {
+			t.Fatal("a is still tracked")
+		}
+	}
+
+	steps := []struct {
+		name    string
+		do      func(t *testing.T)
+		digest  string
+		changed bool
+	}{
+		{
+			name:   "first digest",
+			digest: "1",
+		},
+		{
+			name:   "unchanged across an eviction",
+			do:     evict,
+			digest: "1",
+		},
+		{
+			name:    "changed while evicted",
+			do:      evict,
+			digest:  "2",
+			changed: true,
+		},
+		{
+			name: "removed while evicted",
+			do: func(t *testing.T) {
+				evict(t)
+				s.delete("a")
+			},
+			digest: "3",
+		},
+	}
+
+	for _, step := range steps {
+		if step.do != nil {
+			step.do(t)
+		}
+
+		// the digest from before the eviction is back as soon as the file is seen again
+		s.setInfo("a", "a", nil, r)
+
+		state, _ := s.get("a")
+		previous := ""
+		if state.digest != nil {
+			previous = state.digest.Digest
+		}
+
+		if changed := s.observe("a", digest(step.digest)); changed != step.changed {
+			t.Fatalf("%s: changed %t from %q to %s, want %t", step.name, changed, previous, step.digest, step.changed)
+		}
+
+		// b was evicted in turn, it was never hashed so nothing is kept for it
+		if len(s.digests) != 0 {
+			t.Fatalf("%s: %d digests kept for evicted files, want none", step.name, len(s.digests))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package monitor
+
+import (
+	"sort"
+	"time"
+)
+
+// PathStatus is the state of a configured path
+type PathStatus struct {
+	// Path is the path as configured, without the rootfs
+	Path      string `json:"path"`
+	Recursive bool   `json:"recursive"`
+
+	// State is one of PathStates
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+
+	// MissingSince is when the path was first found missing
+	MissingSince *time.Time `json:"missing_since,omitempty"`
+
+	// RetryAt is when a path that is not active is tried again
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+
+	// Files is the number of tracked files under the path
+	Files int `json:"files"`
+
+	// LastEvent and LastOp are the most recent event on any file under the path
+	LastEvent *time.Time `json:"last_event,omitempty"`
+	LastOp    string     `json:"last_op,omitempty"`
+}
+
+// FileStatus is what the monitor knows about a file
+type FileStatus struct {
+	// Path is the path of the file without the rootfs, as exported on the metrics
+	Path string `json:"path"`
+
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+
+	// Algorithm, Digest and Policy are empty until the file has been hashed
+	Algorithm string `json:"algorithm,omitempty"`
+	Digest    string `json:"digest,omitempty"`
+	CRC32     uint32 `json:"crc32"`
+	Policy    string `json:"policy,omitempty"`
+
+	LastEvent *time.Time `json:"last_event,omitempty"`
+	LastOp    string     `json:"last_op,omitempty"`
+}
+
+// Paths returns the state of every configured path in the order they were configured
+func (m *Monitor) Paths() []PathStatus {
+	rules := m.snapshot()
+
+	statuses := make([]PathStatus, 0, len(rules))
+	for _, r := range rules {
+		status := PathStatus{
+			Path:      r.Path.Path,
+			Recursive: r.Recursive,
+			State:     PathPending,
+		}
+
+		m.pathsMu.Lock()
+		if st, ok := m.paths[r]; ok {
+			status.State = st.state
+			if st.err != nil {
+				status.Error = st.err.Error()
+			}
+			status.MissingSince = timePtr(st.missingSince)
+			if st.state != PathActive {
+				status.RetryAt = timePtr(st.retryAt)
+			}
+		}
+		m.pathsMu.Unlock()
+
+		var lastEvent time.Time
+		status.Files, lastEvent, status.LastOp = r.activity()
+		status.LastEvent = timePtr(lastEvent)
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// Files returns the state of every tracked file sorted by path
+func (m *Monitor) Files() []FileStatus {
+	states := m.state.snapshot()
+
+	files := make([]FileStatus, 0, len(states))
+	for _, state := range states {
+		files = append(files, newFileStatus(state))
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files
+}
+
+// File returns the state of a tracked file by the path it is exported as
+func (m *Monitor) File(path string) (FileStatus, bool) {
+	state, ok := m.state.get(path)
+	if !ok {
+		return FileStatus{}, false
+	}
+
+	return newFileStatus(state), true
+}
+
+func newFileStatus(state fileState) FileStatus {
+	status := FileStatus{
+		Path:      state.metricPath,
+		LastEvent: timePtr(state.lastEvent),
+		LastOp:    state.lastOp,
+	}
+
+	if state.info != nil {
+		status.Size = state.info.Size()
+		status.Mode = state.info.Mode().String()
+		status.ModTime = state.info.ModTime()
+		status.IsDir = state.info.IsDir()
+	}
+
+	if state.digest != nil {
+		status.Algorithm = state.digest.Algorithm
+		status.Digest = state.digest.Digest
+		status.CRC32 = state.digest.CRC32
+		status.Policy = state.digest.Policy
+	}
+
+	return status
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
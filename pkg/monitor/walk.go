@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+)
+
+// WalkFunc is called by Walk for every file, path includes the rootfs and metricPath is the path
+// as reported on the metrics. A path of the config that cannot be listed is passed with its error
+// and a nil stat, returning an error stops the walk.
+type WalkFunc func(path string, metricPath string, stat *FileStat, err error) error
+
+// Walk calls fn for every file the paths of the config match, in lexical order. Files are listed
+// as a monitor would watch them, with the same rootfs, glob and regex handling, and are only
+// visited once when several paths match them.
+func Walk(cfg *config.Config, fn WalkFunc) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	logEntry := logrus.WithField("component", "walk")
+
+	files := map[string]*FileStat{}
+
+	for _, p := range cfg.Paths {
+		p.ApplyDefaults(config.Path{})
+
+		r, err := newRule(p, cfg.RootFS, config.BackendPoll, nil)
+		if err != nil {
+			return err
+		}
+
+		path := r.absPath(logEntry)
+
+		matches := []string{path}
+		if r.glob {
+			if matches, err = filepath.Glob(path); err != nil {
+				return err
+			}
+
+			if len(matches) == 0 {
+				if err := fn(path, toMetricPath(path, cfg.RootFS), nil, os.ErrNotExist); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, match := range matches {
+			if err := r.add(match); err != nil {
+				if err := fn(match, toMetricPath(match, cfg.RootFS), nil, err); err != nil {
+					return err
+				}
+			}
+		}
+
+		for file, info := range r.watcher.WatchedFiles() {
+			if info.IsDir() {
+				continue
+			}
+
+			files[filepath.Clean(file)] = newFileStat(info)
+		}
+
+		r.watcher.Close()
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := fn(path, toMetricPath(path, cfg.RootFS), files[path], nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+// Package retry spaces out the attempts of operations that keep failing
+package retry
+
+import "time"
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts,
+// starting at base and doubling on every attempt up to maxDelay
+func Backoff(attempts int, base time.Duration, maxDelay time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxDelay)
+}
@@ -0,0 +1,31 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		base     time.Duration
+		maxDelay time.Duration
+		want     time.Duration
+	}{
+		{attempts: 0, base: time.Second, maxDelay: 5 * time.Minute, want: time.Second},
+		{attempts: 1, base: time.Second, maxDelay: 5 * time.Minute, want: time.Second},
+		{attempts: 2, base: time.Second, maxDelay: 5 * time.Minute, want: 2 * time.Second},
+		{attempts: 3, base: time.Second, maxDelay: 5 * time.Minute, want: 4 * time.Second},
+		{attempts: 9, base: time.Second, maxDelay: 5 * time.Minute, want: 256 * time.Second},
+		{attempts: 10, base: time.Second, maxDelay: 5 * time.Minute, want: 5 * time.Minute},
+		{attempts: 1000, base: time.Second, maxDelay: 5 * time.Minute, want: 5 * time.Minute},
+		{attempts: 3, base: 100 * time.Millisecond, maxDelay: time.Second, want: 400 * time.Millisecond},
+		{attempts: 1, base: time.Minute, maxDelay: time.Second, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts, tt.base, tt.maxDelay); got != tt.want {
+			t.Errorf("Backoff(%d, %s, %s) = %s, want %s", tt.attempts, tt.base, tt.maxDelay, got, tt.want)
+		}
+	}
+}
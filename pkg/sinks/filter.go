@@ -0,0 +1,101 @@
+package sinks
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// Filter selects events by path glob and op, an empty filter selects every event
+type Filter struct {
+	paths []*regexp.Regexp
+	ops   []string
+}
+
+// NewFilter compiles the path globs, * and ? do not match a separator while ** matches across
+// them. Ops are compared case insensitively.
+func NewFilter(paths []string, ops []string) (*Filter, error) {
+	filter := &Filter{ops: ops}
+
+	for _, glob := range paths {
+		re, err := globRegexp(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path glob %q: %w", glob, err)
+		}
+
+		filter.paths = append(filter.paths, re)
+	}
+
+	return filter, nil
+}
+
+// Match reports whether the path or old path of the event matches one of the globs and its op
+// one of the ops
+func (f *Filter) Match(event monitor.Event) bool {
+	if len(f.ops) > 0 {
+		var ok bool
+		for _, op := range f.ops {
+			if strings.EqualFold(op, event.Op) {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	if len(f.paths) == 0 {
+		return true
+	}
+
+	for _, re := range f.paths {
+		if re.MatchString(event.Path) || (event.OldPath != "" && re.MatchString(event.OldPath)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated character class")
+			}
+
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
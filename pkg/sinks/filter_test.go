@@ -0,0 +1,121 @@
+package sinks
+
+import (
+	"testing"
+
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		ops   []string
+		event monitor.Event
+		want  bool
+	}{
+		{
+			name:  "empty filter",
+			event: monitor.Event{Op: "WRITE", Path: "/etc/passwd"},
+			want:  true,
+		},
+		{
+			name:  "op",
+			ops:   []string{"WRITE", "REMOVE"},
+			event: monitor.Event{Op: "REMOVE", Path: "/etc/passwd"},
+			want:  true,
+		},
+		{
+			name:  "op case insensitive",
+			ops:   []string{"write"},
+			event: monitor.Event{Op: "WRITE", Path: "/etc/passwd"},
+			want:  true,
+		},
+		{
+			name:  "other op",
+			ops:   []string{"WRITE"},
+			event: monitor.Event{Op: "CHMOD", Path: "/etc/passwd"},
+			want:  false,
+		},
+		{
+			name:  "star stays in a directory",
+			paths: []string{"/etc/*.conf"},
+			event: monitor.Event{Op: "WRITE", Path: "/etc/nginx/nginx.conf"},
+			want:  false,
+		},
+		{
+			name:  "star",
+			paths: []string{"/etc/*.conf"},
+			event: monitor.Event{Op: "WRITE", Path: "/etc/resolv.conf"},
+			want:  true,
+		},
+		{
+			name:  "double star crosses directories",
+			paths: []string{"/etc/**.conf"},
+			event: monitor.Event{Op: "WRITE", Path: "/etc/nginx/nginx.conf"},
+			want:  true,
+		},
+		{
+			name:  "question mark",
+			paths: []string{"/var/log/app.?"},
+			event: monitor.Event{Op: "WRITE", Path: "/var/log/app.1"},
+			want:  true,
+		},
+		{
+			name:  "question mark stays in a directory",
+			paths: []string{"/var/log/app?1"},
+			event: monitor.Event{Op: "WRITE", Path: "/var/log/app/1"},
+			want:  false,
+		},
+		{
+			name:  "character class",
+			paths: []string{"/etc/shadow[-~]"},
+			event: monitor.Event{Op: "WRITE", Path: "/etc/shadow-"},
+			want:  true,
+		},
+		{
+			name:  "negated character class",
+			paths: []string{"/etc/shadow[!-~]"},
+			event: monitor.Event{Op: "WRITE", Path: "/etc/shadow-"},
+			want:  false,
+		},
+		{
+			name:  "regexp characters are literal",
+			paths: []string{"/etc/a+b.conf"},
+			event: monitor.Event{Op: "WRITE", Path: "/etc/aab.conf"},
+			want:  false,
+		},
+		{
+			name:  "old path of a rename",
+			paths: []string{"/etc/*.conf"},
+			event: monitor.Event{Op: "RENAME", Path: "/tmp/x", OldPath: "/etc/hosts.conf"},
+			want:  true,
+		},
+		{
+			name:  "path and op",
+			paths: []string{"/etc/**"},
+			ops:   []string{"REMOVE"},
+			event: monitor.Event{Op: "WRITE", Path: "/etc/passwd"},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(tt.paths, tt.ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := f.Match(tt.event); got != tt.want {
+				t.Fatalf("Match(%+v) = %t, want %t", tt.event, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterInvalidGlob(t *testing.T) {
+	if _, err := NewFilter([]string{"/etc/[abc"}, nil); err == nil {
+		t.Fatal("expected an error for an unterminated character class")
+	}
+}
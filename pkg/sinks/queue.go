@@ -0,0 +1,165 @@
+package sinks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sans-sroc/file_exporter/pkg/atomicfile"
+)
+
+// queueItem is a payload waiting to be delivered
+type queueItem struct {
+	seq  uint64
+	data []byte
+}
+
+// queue is a bounded FIFO of payloads, the oldest are dropped once it is full. With a directory
+// every payload is also written to its own file so undelivered payloads survive a restart.
+type queue struct {
+	dir  string
+	size int
+
+	mu     sync.Mutex
+	items  []queueItem
+	seq    uint64
+	notify chan struct{}
+}
+
+func newQueue(dir string, size int) (*queue, error) {
+	q := &queue{
+		dir:    dir,
+		size:   size,
+		notify: make(chan struct{}, 1),
+	}
+
+	if dir == "" {
+		return q, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		q.items = append(q.items, queueItem{seq: seq, data: data})
+	}
+
+	sort.Slice(q.items, func(i, j int) bool {
+		return q.items[i].seq < q.items[j].seq
+	})
+
+	if len(q.items) > 0 {
+		q.seq = q.items[len(q.items)-1].seq
+	}
+
+	for len(q.items) > q.size {
+		q.remove(q.items[0])
+		q.items = q.items[1:]
+	}
+
+	return q, nil
+}
+
+// push appends a payload and returns the number of payloads dropped to make room for it
+func (q *queue) push(data []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	item := queueItem{seq: q.seq, data: data}
+
+	if q.dir != "" {
+		if err := q.write(item); err != nil {
+			return 0, err
+		}
+	}
+
+	q.items = append(q.items, item)
+
+	var dropped int
+	for len(q.items) > q.size {
+		q.remove(q.items[0])
+		q.items = q.items[1:]
+		dropped++
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return dropped, nil
+}
+
+// peek returns the oldest payload without removing it
+func (q *queue) peek() (queueItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return queueItem{}, false
+	}
+
+	return q.items[0], true
+}
+
+// pop removes a payload returned by peek, unless it was dropped in the meantime
+func (q *queue) pop(item queueItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 || q.items[0].seq != item.seq {
+		return
+	}
+
+	q.remove(item)
+	q.items = q.items[1:]
+}
+
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+func (q *queue) path(item queueItem) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d.json", item.seq))
+}
+
+// write stores a payload atomically in its own file
+func (q *queue) write(item queueItem) error {
+	return atomicfile.WriteFile(q.path(item), item.data, 0o600)
+}
+
+// remove deletes the file of a payload, q.mu must be held
+func (q *queue) remove(item queueItem) {
+	if q.dir != "" {
+		_ = os.Remove(q.path(item))
+	}
+}
@@ -0,0 +1,158 @@
+package sinks
+
+import (
+	"os"
+	"testing"
+)
+
+func TestQueueOverflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		pushes  int
+		dropped []int
+		want    []string
+	}{
+		{
+			name:    "below size",
+			size:    3,
+			pushes:  2,
+			dropped: []int{0, 0},
+			want:    []string{"0", "1"},
+		},
+		{
+			name:    "oldest dropped first",
+			size:    2,
+			pushes:  4,
+			dropped: []int{0, 0, 1, 1},
+			want:    []string{"2", "3"},
+		},
+		{
+			name:    "single slot",
+			size:    1,
+			pushes:  3,
+			dropped: []int{0, 1, 1},
+			want:    []string{"2"},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, persisted := range []bool{false, true} {
+			name := tt.name
+			if persisted {
+				name += " on disk"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				var dir string
+				if persisted {
+					dir = t.TempDir()
+				}
+
+				q, err := newQueue(dir, tt.size)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for i := 0; i < tt.pushes; i++ {
+					dropped, err := q.push([]byte{byte('0' + i)})
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if dropped != tt.dropped[i] {
+						t.Fatalf("push %d dropped %d, want %d", i, dropped, tt.dropped[i])
+					}
+				}
+
+				if !persisted {
+					checkQueue(t, q, tt.want)
+					return
+				}
+
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(entries) != len(tt.want) {
+					t.Fatalf("%d files left in the queue directory, want %d", len(entries), len(tt.want))
+				}
+
+				// a new queue picks up the payloads that were not delivered
+				reopened, err := newQueue(dir, tt.size)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				checkQueue(t, reopened, tt.want)
+			})
+		}
+	}
+}
+
+func TestQueueShrinksOnOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := newQueue(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"a", "b", "c"} {
+		if _, err := q.push([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	smaller, err := newQueue(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkQueue(t, smaller, []string{"c"})
+}
+
+func TestQueuePopDropped(t *testing.T) {
+	q, err := newQueue("", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := q.push([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	item, _ := q.peek()
+
+	// the item being delivered is dropped to make room
+	if _, err := q.push([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	q.pop(item)
+
+	checkQueue(t, q, []string{"b"})
+}
+
+// checkQueue pops every payload of the queue and compares them with want
+func checkQueue(t *testing.T, q *queue, want []string) {
+	t.Helper()
+
+	if q.len() != len(want) {
+		t.Fatalf("queue holds %d payloads, want %d", q.len(), len(want))
+	}
+
+	for _, w := range want {
+		item, ok := q.peek()
+		if !ok {
+			t.Fatalf("queue is empty, want %q", w)
+		}
+
+		if string(item.data) != w {
+			t.Fatalf("payload %q, want %q", item.data, w)
+		}
+
+		q.pop(item)
+	}
+}
@@ -0,0 +1,77 @@
+// Package sinks delivers the events of a monitor to external systems
+package sinks
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// Sink consumes the events of a monitor until the channel is closed
+type Sink interface {
+	// Name identifies the sink in the metrics of the monitor, as its kind and configured name
+	Name() string
+
+	Run(events <-chan monitor.Event)
+}
+
+// Options are shared by every sink
+type Options struct {
+	// Registerer is where the metrics of the sink are registered, the default registerer is used when nil
+	Registerer prometheus.Registerer
+
+	// Logger is the default logger when nil
+	Logger *logrus.Logger
+}
+
+func (o Options) registerer() prometheus.Registerer {
+	if o.Registerer == nil {
+		return prometheus.DefaultRegisterer
+	}
+
+	return o.Registerer
+}
+
+func (o Options) logger() *logrus.Logger {
+	if o.Logger == nil {
+		return logrus.StandardLogger()
+	}
+
+	return o.Logger
+}
+
+// register registers a collector, or returns the one already registered so sinks of the same
+// kind share their metrics
+func register[T prometheus.Collector](reg prometheus.Registerer, c T) (T, error) {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(T); ok {
+				return existing, nil
+			}
+		}
+
+		return c, err
+	}
+
+	return c, nil
+}
+
+// readSecret returns the secret, or the content of the file when one is given
+func readSecret(secret string, file string) ([]byte, error) {
+	if file == "" {
+		return []byte(secret), nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(strings.TrimSpace(string(data))), nil
+}
@@ -0,0 +1,365 @@
+package sinks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// Defaults of a syslog server
+const (
+	DefaultSyslogFacility = "local0"
+	DefaultSyslogAppName  = "file_exporter"
+
+	// DefaultSyslogSDID uses the private enterprise number reserved for documentation, set sd_id to
+	// one of your own when the receiver validates it
+	DefaultSyslogSDID = "file@32473"
+)
+
+const syslogTimeout = 5 * time.Second
+
+// Severities of the messages, every event is a notice except changes made while offline
+const (
+	severityWarning = 4
+	severityNotice  = 5
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+type syslogMetrics struct {
+	messages *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+}
+
+func newSyslogMetrics(reg prometheus.Registerer) (*syslogMetrics, error) {
+	var m syslogMetrics
+	var err error
+
+	if m.messages, err = register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "file_exporter_syslog_messages_total",
+		Help: "Events sent to a syslog server",
+	}, []string{"syslog"})); err != nil {
+		return nil, err
+	}
+
+	if m.errors, err = register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "file_exporter_syslog_errors_total",
+		Help: "Events that could not be sent to a syslog server",
+	}, []string{"syslog"})); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Syslog sends an RFC 5424 message with the details of the event as structured data for every
+// event selected by its filter. Messages are written as they come regardless of the log level,
+// a connection that fails is dialed again once before the message is dropped.
+type Syslog struct {
+	cfg       config.Syslog
+	filter    *Filter
+	facility  int
+	hostname  string
+	procID    string
+	tlsConfig *tls.Config
+	metrics   *syslogMetrics
+	logEntry  *logrus.Entry
+
+	conn net.Conn
+}
+
+// NewSyslog creates a syslog sink, the connection is made with the first message
+func NewSyslog(cfg config.Syslog, opts Options) (*Syslog, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Network == "" {
+		cfg.Network = config.SyslogUnix
+	}
+	if cfg.Address == "" {
+		cfg.Address = config.DefaultSyslogSocket
+	}
+	if cfg.Facility == "" {
+		cfg.Facility = DefaultSyslogFacility
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = DefaultSyslogAppName
+	}
+	if cfg.SDID == "" {
+		cfg.SDID = DefaultSyslogSDID
+	}
+
+	facility, ok := syslogFacilities[cfg.Facility]
+	if !ok {
+		return nil, fmt.Errorf("syslog %s: unsupported facility %q", cfg.Name, cfg.Facility)
+	}
+
+	if !validSDName(cfg.SDID) {
+		return nil, fmt.Errorf("syslog %s: invalid sd_id %q", cfg.Name, cfg.SDID)
+	}
+
+	hostname := cfg.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	filter, err := NewFilter(cfg.Paths, cfg.Ops)
+	if err != nil {
+		return nil, fmt.Errorf("syslog %s: %w", cfg.Name, err)
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.Network == config.SyslogTLS {
+		if tlsConfig, err = newTLSConfig(cfg.TLS); err != nil {
+			return nil, fmt.Errorf("syslog %s: %w", cfg.Name, err)
+		}
+	}
+
+	metrics, err := newSyslogMetrics(opts.registerer())
+	if err != nil {
+		return nil, fmt.Errorf("unable to register syslog metrics: %w", err)
+	}
+
+	return &Syslog{
+		cfg:       cfg,
+		filter:    filter,
+		facility:  facility,
+		hostname:  headerField(hostname, 255),
+		procID:    strconv.Itoa(os.Getpid()),
+		tlsConfig: tlsConfig,
+		metrics:   metrics,
+		logEntry:  opts.logger().WithField("component", "syslog").WithField("syslog", cfg.Name),
+	}, nil
+}
+
+// Name returns syslog/ followed by the name of the server
+func (s *Syslog) Name() string {
+	return "syslog/" + s.cfg.Name
+}
+
+// Run sends the events selected by the filter until the channel is closed
+func (s *Syslog) Run(events <-chan monitor.Event) {
+	defer func() {
+		if s.conn != nil {
+			s.conn.Close()
+		}
+	}()
+
+	for event := range events {
+		if !s.filter.Match(event) {
+			continue
+		}
+
+		if err := s.write(s.format(event)); err != nil {
+			s.logEntry.WithError(err).WithField("path", event.Path).Error("unable to send event to syslog")
+			s.metrics.errors.WithLabelValues(s.cfg.Name).Inc()
+			continue
+		}
+
+		s.metrics.messages.WithLabelValues(s.cfg.Name).Inc()
+	}
+}
+
+// format renders an event as an RFC 5424 message
+func (s *Syslog) format(event monitor.Event) []byte {
+	severity := severityNotice
+	if event.Op == monitor.OpOfflineChange {
+		severity = severityWarning
+	}
+
+	var sd strings.Builder
+	sd.WriteString("[" + s.cfg.SDID)
+
+	param := func(name string, value string) {
+		sd.WriteString(" " + name + `="` + sdEscape(value) + `"`)
+	}
+
+	param("path", event.Path)
+	param("op", event.Op)
+
+	if event.OldPath != "" {
+		param("old_path", event.OldPath)
+	}
+
+	if event.Before != nil && event.Before.Digest != "" {
+		param("hash_before", event.Before.Algorithm+":"+event.Before.Digest)
+	}
+
+	if event.After != nil && event.After.Digest != "" {
+		param("hash_after", event.After.Algorithm+":"+event.After.Digest)
+	}
+
+	stat := event.AfterStat
+	if stat == nil {
+		stat = event.BeforeStat
+	}
+
+	if stat != nil {
+		param("size", strconv.FormatInt(stat.Size, 10))
+		param("mode", stat.Mode)
+
+		if stat.UID != nil {
+			param("uid", strconv.FormatUint(*stat.UID, 10))
+		}
+
+		if stat.GID != nil {
+			param("gid", strconv.FormatUint(*stat.GID, 10))
+		}
+	}
+
+	sd.WriteString("]")
+
+	msg := event.Op + " " + event.Path
+	if event.OldPath != "" {
+		msg = event.Op + " " + event.OldPath + " -> " + event.Path
+	}
+
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %s %s %s %s",
+		s.facility*8+severity,
+		event.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname,
+		headerField(s.cfg.AppName, 48),
+		s.procID,
+		headerField(event.Op, 32),
+		sd.String(),
+		msg,
+	))
+}
+
+// write sends a message, dialing the server again once when the connection fails
+func (s *Syslog) write(msg []byte) error {
+	// stream transports frame messages by their length (RFC 6587)
+	if s.cfg.Network == config.SyslogTCP || s.cfg.Network == config.SyslogTLS {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if s.conn, err = s.dial(); err != nil {
+				return err
+			}
+		}
+
+		_ = s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+
+		if _, err = s.conn.Write(msg); err == nil {
+			return nil
+		}
+
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	return err
+}
+
+func (s *Syslog) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+
+	switch s.cfg.Network {
+	case config.SyslogTLS:
+		return tls.DialWithDialer(dialer, "tcp", s.cfg.Address, s.tlsConfig)
+	case config.SyslogUnix:
+		// local daemons listen on a datagram socket, some on a stream socket
+		conn, err := dialer.Dial("unixgram", s.cfg.Address)
+		if err == nil {
+			return conn, nil
+		}
+
+		return dialer.Dial("unix", s.cfg.Address)
+	}
+
+	return dialer.Dial(s.cfg.Network, s.cfg.Address)
+}
+
+func newTLSConfig(cfg config.TLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates found in ca_file")
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// headerField makes a value usable in the header, which only allows printable ASCII without spaces
+func headerField(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+
+	if value == "" {
+		return "-"
+	}
+
+	if len(value) > max {
+		value = value[:max]
+	}
+
+	return value
+}
+
+// validSDName checks an SD-ID, it is printable ASCII without =, space, ] or "
+func validSDName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+
+	for _, r := range name {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sdEscape escapes the characters that must be escaped in a structured data parameter value
+func sdEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
@@ -0,0 +1,119 @@
+package sinks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/hasher"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+func TestSDEscape(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "/etc/passwd", want: "/etc/passwd"},
+		{value: `a"b`, want: `a\"b`},
+		{value: `a\b`, want: `a\\b`},
+		{value: "a]b", want: `a\]b`},
+		{value: `\"]`, want: `\\\"\]`},
+		{value: "[a=b c]", want: `[a=b c\]`},
+		{value: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := sdEscape(tt.value); got != tt.want {
+			t.Errorf("sdEscape(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSyslogFormat(t *testing.T) {
+	uid := uint64(0)
+	at := time.Date(2026, 10, 18, 5, 47, 0, 123456000, time.UTC)
+
+	tests := []struct {
+		name  string
+		cfg   config.Syslog
+		event monitor.Event
+		want  string
+	}{
+		{
+			name: "write",
+			event: monitor.Event{
+				Time:      at,
+				Op:        "WRITE",
+				Path:      "/etc/passwd",
+				Before:    &hasher.Result{Algorithm: "sha256", Digest: "aa"},
+				After:     &hasher.Result{Algorithm: "sha256", Digest: "bb"},
+				AfterStat: &monitor.FileStat{Size: 10, Mode: "-rw-r--r--", UID: &uid, GID: &uid},
+			},
+			want: `<133>1 2026-10-18T05:47:00.123456Z host file_exporter 42 WRITE [file@32473 path="/etc/passwd" op="WRITE" hash_before="sha256:aa" hash_after="sha256:bb" size="10" mode="-rw-r--r--" uid="0" gid="0"] WRITE /etc/passwd`,
+		},
+		{
+			name: "rename",
+			event: monitor.Event{
+				Time:    at,
+				Op:      "RENAME",
+				Path:    "/etc/b",
+				OldPath: "/etc/a",
+			},
+			want: `<133>1 2026-10-18T05:47:00.123456Z host file_exporter 42 RENAME [file@32473 path="/etc/b" op="RENAME" old_path="/etc/a"] RENAME /etc/a -> /etc/b`,
+		},
+		{
+			name: "remove reports the stat before",
+			event: monitor.Event{
+				Time:       at,
+				Op:         "REMOVE",
+				Path:       "/etc/a",
+				BeforeStat: &monitor.FileStat{Size: 3, Mode: "-rw-------"},
+			},
+			want: `<133>1 2026-10-18T05:47:00.123456Z host file_exporter 42 REMOVE [file@32473 path="/etc/a" op="REMOVE" size="3" mode="-rw-------"] REMOVE /etc/a`,
+		},
+		{
+			name: "offline change is a warning",
+			cfg:  config.Syslog{Facility: "auth"},
+			event: monitor.Event{
+				Time: at,
+				Op:   monitor.OpOfflineChange,
+				Path: "/etc/a",
+			},
+			want: `<36>1 2026-10-18T05:47:00.123456Z host file_exporter 42 offline_change [file@32473 path="/etc/a" op="offline_change"] offline_change /etc/a`,
+		},
+		{
+			name: "escaped values",
+			cfg:  config.Syslog{AppName: "file exporter", SDID: "fim@12345"},
+			event: monitor.Event{
+				Time: at,
+				Op:   "CREATE",
+				Path: `/tmp/a"b]c\d`,
+			},
+			want: `<133>1 2026-10-18T05:47:00.123456Z host file_exporter 42 CREATE [fim@12345 path="/tmp/a\"b\]c\\d" op="CREATE"] CREATE /tmp/a"b]c\d`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Name = "test"
+			cfg.Network = config.SyslogUDP
+			cfg.Address = "127.0.0.1:514"
+			cfg.Hostname = "host"
+
+			s, err := NewSyslog(cfg, Options{Registerer: prometheus.NewRegistry()})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s.procID = "42"
+
+			if got := string(s.format(tt.event)); got != tt.want {
+				t.Fatalf("format() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
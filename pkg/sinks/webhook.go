@@ -0,0 +1,339 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+	"github.com/sans-sroc/file_exporter/pkg/retry"
+)
+
+// Defaults of a webhook
+const (
+	DefaultWebhookTimeout     = 10 * time.Second
+	DefaultWebhookMaxAttempts = 10
+	DefaultWebhookQueueSize   = 1000
+)
+
+const (
+	// cloudEventType prefixes the lower cased op to form the type of a CloudEvent
+	cloudEventType = "com.github.sans-sroc.file_exporter."
+
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the body, prefixed with sha256=
+	SignatureHeader = "X-File-Exporter-Signature"
+
+	webhookRetryBase = time.Second
+	webhookRetryMax  = 5 * time.Minute
+)
+
+// CloudEvent is a CloudEvents 1.0 document in the structured JSON format
+type CloudEvent struct {
+	SpecVersion     string        `json:"specversion"`
+	ID              string        `json:"id"`
+	Source          string        `json:"source"`
+	Type            string        `json:"type"`
+	Subject         string        `json:"subject"`
+	Time            time.Time     `json:"time"`
+	DataContentType string        `json:"datacontenttype"`
+	Data            monitor.Event `json:"data"`
+}
+
+type webhookMetrics struct {
+	delivered *prometheus.CounterVec
+	failures  *prometheus.CounterVec
+	dropped   *prometheus.CounterVec
+	queued    *prometheus.GaugeVec
+	duration  *prometheus.HistogramVec
+}
+
+func newWebhookMetrics(reg prometheus.Registerer) (*webhookMetrics, error) {
+	var m webhookMetrics
+	var err error
+
+	if m.delivered, err = register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "file_exporter_webhook_delivered_total",
+		Help: "Events delivered to a webhook",
+	}, []string{"webhook"})); err != nil {
+		return nil, err
+	}
+
+	if m.failures, err = register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "file_exporter_webhook_failed_attempts_total",
+		Help: "Attempts to deliver an event to a webhook that failed",
+	}, []string{"webhook"})); err != nil {
+		return nil, err
+	}
+
+	if m.dropped, err = register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "file_exporter_webhook_dropped_total",
+		Help: "Events that were not delivered to a webhook: queue_full, rejected or max_attempts",
+	}, []string{"webhook", "reason"})); err != nil {
+		return nil, err
+	}
+
+	if m.queued, err = register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "file_exporter_webhook_queue_length",
+		Help: "Events waiting to be delivered to a webhook",
+	}, []string{"webhook"})); err != nil {
+		return nil, err
+	}
+
+	if m.duration, err = register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "file_exporter_webhook_request_duration_seconds",
+		Help:    "Time taken by requests to a webhook",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"webhook"})); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Webhook posts every event selected by its filter as a CloudEvent. Events are queued and sent one
+// at a time in order, failed requests are retried with exponential backoff.
+type Webhook struct {
+	cfg      config.Webhook
+	secret   []byte
+	source   string
+	filter   *Filter
+	queue    *queue
+	client   *http.Client
+	metrics  *webhookMetrics
+	logEntry *logrus.Entry
+
+	// ctx stops deliveries, events that are still queued stay on disk for the next start
+	ctx context.Context
+}
+
+// NewWebhook creates a webhook sink, deliveries run until the context is done
+func NewWebhook(ctx context.Context, cfg config.Webhook, opts Options) (*Webhook, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Timeout.Duration == 0 {
+		cfg.Timeout.Duration = DefaultWebhookTimeout
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = DefaultWebhookMaxAttempts
+	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = DefaultWebhookQueueSize
+	}
+
+	secret, err := readSecret(cfg.Secret, cfg.SecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: unable to read secret: %w", cfg.Name, err)
+	}
+
+	filter, err := NewFilter(cfg.Paths, cfg.Ops)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: %w", cfg.Name, err)
+	}
+
+	q, err := newQueue(cfg.QueueDir, cfg.QueueSize)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: unable to open queue: %w", cfg.Name, err)
+	}
+
+	metrics, err := newWebhookMetrics(opts.registerer())
+	if err != nil {
+		return nil, fmt.Errorf("unable to register webhook metrics: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+
+	w := &Webhook{
+		cfg:      cfg,
+		secret:   secret,
+		source:   "file_exporter://" + hostname,
+		filter:   filter,
+		queue:    q,
+		client:   &http.Client{Timeout: cfg.Timeout.Duration},
+		metrics:  metrics,
+		logEntry: opts.logger().WithField("component", "webhook").WithField("webhook", cfg.Name),
+		ctx:      ctx,
+	}
+
+	w.metrics.queued.WithLabelValues(cfg.Name).Set(float64(q.len()))
+
+	return w, nil
+}
+
+// Name returns webhook/ followed by the name of the webhook
+func (w *Webhook) Name() string {
+	return "webhook/" + w.cfg.Name
+}
+
+// Run queues the events selected by the filter and delivers them until the context is done, it
+// returns once the channel is closed
+func (w *Webhook) Run(events <-chan monitor.Event) {
+	go w.deliver()
+
+	for event := range events {
+		if !w.filter.Match(event) {
+			continue
+		}
+
+		data, err := w.encode(event)
+		if err != nil {
+			w.logEntry.WithError(err).Error("unable to encode event")
+			continue
+		}
+
+		dropped, err := w.queue.push(data)
+		if err != nil {
+			w.logEntry.WithError(err).Error("unable to queue event")
+			w.metrics.dropped.WithLabelValues(w.cfg.Name, "queue_full").Inc()
+			continue
+		}
+
+		if dropped > 0 {
+			w.logEntry.WithField("dropped", dropped).Warn("webhook queue is full, dropped the oldest events")
+			w.metrics.dropped.WithLabelValues(w.cfg.Name, "queue_full").Add(float64(dropped))
+		}
+
+		w.metrics.queued.WithLabelValues(w.cfg.Name).Set(float64(w.queue.len()))
+	}
+}
+
+func (w *Webhook) encode(event monitor.Event) ([]byte, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              id,
+		Source:          w.source,
+		Type:            cloudEventType + strings.ToLower(event.Op),
+		Subject:         event.Path,
+		Time:            event.Time,
+		DataContentType: "application/json",
+		Data:            event,
+	})
+}
+
+// deliver sends the queued events in order
+func (w *Webhook) deliver() {
+	for {
+		item, ok := w.queue.peek()
+		if !ok {
+			select {
+			case <-w.queue.notify:
+				continue
+			case <-w.ctx.Done():
+				return
+			}
+		}
+
+		for attempt := 1; ; attempt++ {
+			retryable, err := w.send(item.data)
+			if err == nil {
+				w.metrics.delivered.WithLabelValues(w.cfg.Name).Inc()
+				break
+			}
+
+			if w.ctx.Err() != nil {
+				return
+			}
+
+			w.metrics.failures.WithLabelValues(w.cfg.Name).Inc()
+
+			log := w.logEntry.WithError(err).WithField("attempt", attempt)
+
+			if !retryable {
+				log.Error("webhook rejected event, dropping it")
+				w.metrics.dropped.WithLabelValues(w.cfg.Name, "rejected").Inc()
+				break
+			}
+
+			if attempt >= w.cfg.MaxAttempts {
+				log.Error("unable to deliver event, dropping it")
+				w.metrics.dropped.WithLabelValues(w.cfg.Name, "max_attempts").Inc()
+				break
+			}
+
+			delay := retry.Backoff(attempt, webhookRetryBase, webhookRetryMax)
+			log.WithField("retry_in", delay).Warn("unable to deliver event")
+
+			select {
+			case <-time.After(delay):
+			case <-w.ctx.Done():
+				return
+			}
+		}
+
+		w.queue.pop(item)
+		w.metrics.queued.WithLabelValues(w.cfg.Name).Set(float64(w.queue.len()))
+	}
+}
+
+// send posts a CloudEvent and reports whether a failure is worth retrying, client errors other
+// than timeouts and rate limiting are not
+func (w *Webhook) send(data []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(data)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	start := time.Now()
+	resp, err := w.client.Do(req)
+	w.metrics.duration.WithLabelValues(w.cfg.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return false, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+// newID returns a random version 4 UUID
+func newID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,390 @@
+package sinks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sans-sroc/file_exporter/pkg/config"
+	"github.com/sans-sroc/file_exporter/pkg/monitor"
+)
+
+// webhookServer answers with statuses in order, then with 200, and records every request
+type webhookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []webhookRequest
+	received chan struct{}
+}
+
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	s := &webhookServer{
+		statuses: statuses,
+		received: make(chan struct{}, 100),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		s.requests = append(s.requests, webhookRequest{header: r.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+		s.received <- struct{}{}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// wait waits for n more requests
+func (s *webhookServer) wait(t *testing.T, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.received:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("received %d requests, want %d more", i, n-i)
+		}
+	}
+}
+
+// subjects returns the subject of every request received, in order
+func (s *webhookServer) subjects(t *testing.T) []string {
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subjects := []string{}
+	for _, req := range s.requests {
+		var event CloudEvent
+		if err := json.Unmarshal(req.body, &event); err != nil {
+			t.Fatal(err)
+		}
+		subjects = append(subjects, event.Subject)
+	}
+
+	return subjects
+}
+
+// startWebhook runs a webhook until the test ends, events are sent on the returned channel
+func startWebhook(t *testing.T, ctx context.Context, cfg config.Webhook, reg prometheus.Registerer) chan<- monitor.Event {
+	t.Helper()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	w, err := NewWebhook(ctx, cfg, Options{Registerer: reg, Logger: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan monitor.Event)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		w.Run(events)
+	}()
+
+	t.Cleanup(func() {
+		close(events)
+		<-done
+	})
+
+	return events
+}
+
+func TestWebhookCloudEvent(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("from a file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		secret     string
+		secretFile string
+		signedWith string
+	}{
+		{
+			name: "unsigned",
+		},
+		{
+			name:       "secret",
+			secret:     "s3cret",
+			signedWith: "s3cret",
+		},
+		{
+			name:       "secret file",
+			secretFile: secretFile,
+			signedWith: "from a file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t)
+
+			events := startWebhook(t, context.Background(), config.Webhook{
+				Name:       "test",
+				URL:        server.URL,
+				Secret:     tt.secret,
+				SecretFile: tt.secretFile,
+				Headers:    map[string]string{"X-Tenant": "ops"},
+			}, prometheus.NewRegistry())
+
+			sent := monitor.Event{Time: time.Now().UTC().Truncate(time.Second), Op: "WRITE", Path: "/etc/passwd"}
+			events <- sent
+			server.wait(t, 1)
+
+			req := server.requests[0]
+
+			if got := req.header.Get("Content-Type"); got != "application/cloudevents+json; charset=utf-8" {
+				t.Errorf("content type %q", got)
+			}
+
+			if got := req.header.Get("X-Tenant"); got != "ops" {
+				t.Errorf("configured header %q, want ops", got)
+			}
+
+			signature := req.header.Get(SignatureHeader)
+			if tt.signedWith == "" {
+				if signature != "" {
+					t.Errorf("unsigned request carries %s: %s", SignatureHeader, signature)
+				}
+			} else {
+				mac := hmac.New(sha256.New, []byte(tt.signedWith))
+				mac.Write(req.body)
+
+				if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+					t.Errorf("signature %q, want %q", signature, want)
+				}
+			}
+
+			var event CloudEvent
+			if err := json.Unmarshal(req.body, &event); err != nil {
+				t.Fatal(err)
+			}
+
+			if event.SpecVersion != "1.0" || event.ID == "" || !strings.HasPrefix(event.Source, "file_exporter://") {
+				t.Errorf("invalid cloud event attributes %+v", event)
+			}
+
+			if event.Type != "com.github.sans-sroc.file_exporter.write" || event.Subject != sent.Path || event.DataContentType != "application/json" {
+				t.Errorf("type %q, subject %q and data content type %q", event.Type, event.Subject, event.DataContentType)
+			}
+
+			if !event.Time.Equal(sent.Time) || !reflect.DeepEqual(event.Data.Path, sent.Path) || event.Data.Op != sent.Op {
+				t.Errorf("data %+v, want %+v", event.Data, sent)
+			}
+		})
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		maxAttempts int
+
+		// requests is the number of requests made for the first event, a second event is sent
+		// once it was delivered or dropped
+		requests  int
+		delivered float64
+		dropped   map[string]float64
+	}{
+		{
+			name:      "delivered",
+			requests:  1,
+			delivered: 2,
+		},
+		{
+			name:      "retried on a server error",
+			statuses:  []int{http.StatusServiceUnavailable},
+			requests:  2,
+			delivered: 2,
+		},
+		{
+			name:      "retried on a timeout",
+			statuses:  []int{http.StatusRequestTimeout},
+			requests:  2,
+			delivered: 2,
+		},
+		{
+			name:      "retried when rate limited",
+			statuses:  []int{http.StatusTooManyRequests},
+			requests:  2,
+			delivered: 2,
+		},
+		{
+			name:      "not retried on a client error",
+			statuses:  []int{http.StatusBadRequest},
+			requests:  1,
+			delivered: 1,
+			dropped:   map[string]float64{"rejected": 1},
+		},
+		{
+			name:      "not retried when not found",
+			statuses:  []int{http.StatusNotFound},
+			requests:  1,
+			delivered: 1,
+			dropped:   map[string]float64{"rejected": 1},
+		},
+		{
+			name:        "dropped after max attempts",
+			statuses:    []int{http.StatusInternalServerError, http.StatusBadGateway},
+			maxAttempts: 2,
+			requests:    2,
+			delivered:   1,
+			dropped:     map[string]float64{"max_attempts": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newWebhookServer(t, tt.statuses...)
+			reg := prometheus.NewRegistry()
+
+			events := startWebhook(t, context.Background(), config.Webhook{
+				Name:        "test",
+				URL:         server.URL,
+				MaxAttempts: tt.maxAttempts,
+			}, reg)
+
+			events <- monitor.Event{Op: "WRITE", Path: "/first"}
+			events <- monitor.Event{Op: "WRITE", Path: "/second"}
+
+			server.wait(t, tt.requests+1)
+
+			want := []string{}
+			for i := 0; i < tt.requests; i++ {
+				want = append(want, "/first")
+			}
+			want = append(want, "/second")
+
+			if got := server.subjects(t); !reflect.DeepEqual(got, want) {
+				t.Fatalf("requests for %v, want %v", got, want)
+			}
+
+			metrics := webhookMetricsOf(t, reg)
+
+			// the counters are updated once the response has been handled
+			for deadline := time.Now().Add(5 * time.Second); testutil.ToFloat64(metrics.delivered.WithLabelValues("test")) != tt.delivered; {
+				if time.Now().After(deadline) {
+					t.Fatalf("delivered %v events, want %v", testutil.ToFloat64(metrics.delivered.WithLabelValues("test")), tt.delivered)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			for _, reason := range []string{"rejected", "max_attempts", "queue_full"} {
+				if got := testutil.ToFloat64(metrics.dropped.WithLabelValues("test", reason)); got != tt.dropped[reason] {
+					t.Errorf("dropped %v events for %s, want %v", got, reason, tt.dropped[reason])
+				}
+			}
+
+			if got := testutil.ToFloat64(metrics.failures.WithLabelValues("test")); got != float64(len(tt.statuses)) {
+				t.Errorf("%v failed attempts, want %d", got, len(tt.statuses))
+			}
+		})
+	}
+}
+
+func TestWebhookReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	// the first run cannot deliver anything, its events stay on disk when it stops
+	down := newWebhookServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events := startWebhook(t, ctx, config.Webhook{
+		Name:     "test",
+		URL:      down.URL,
+		QueueDir: dir,
+	}, prometheus.NewRegistry())
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		events <- monitor.Event{Op: "WRITE", Path: path}
+	}
+
+	down.wait(t, 1)
+	cancel()
+
+	queued := func() int {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+
+	if got := queued(); got != 3 {
+		t.Fatalf("%d events queued on disk, want 3", got)
+	}
+
+	// after a restart the queued events are delivered in order without any new event
+	up := newWebhookServer(t)
+
+	startWebhook(t, context.Background(), config.Webhook{
+		Name:     "test",
+		URL:      up.URL,
+		QueueDir: dir,
+	}, prometheus.NewRegistry())
+
+	up.wait(t, 3)
+
+	if got, want := up.subjects(t), []string{"/a", "/b", "/c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("replayed %v, want %v", got, want)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); queued() > 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d events still queued on disk after delivery", queued())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// webhookMetricsOf returns the webhook metrics registered on a registry
+func webhookMetricsOf(t *testing.T, reg prometheus.Registerer) *webhookMetrics {
+	t.Helper()
+
+	metrics, err := newWebhookMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return metrics
+}